@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/pkg/errors"
+)
+
+// reference is a reference found in a document, as it was written
+type reference struct {
+	// Pointer is the JSON pointer to the object holding the reference
+	Pointer string
+	// Ref is the reference itself
+	Ref string
+	// Target is the reference, resolved against the URI of the document
+	Target string
+}
+
+// document is a document loaded by the loader
+type document struct {
+	uri       string
+	value     interface{}
+	refs      []reference
+	positions func(string) (jsref.Position, bool)
+}
+
+// position returns the position of the value at `ptr`, if known
+func (doc *document) position(ptr string) (jsref.Position, bool) {
+	if doc.positions == nil {
+		return jsref.Position{}, false
+	}
+	return doc.positions(ptr)
+}
+
+// loader is the Provider used by the command. JSON documents are
+// loaded through the FS, HTTP and Data providers, YAML documents are
+// decoded by the loader itself. Relative references in the loaded
+// documents are made absolute, so that the resolver can follow them
+// regardless of the document they were found in.
+type loader struct {
+	root string
+	fs   *provider.FS
+	http *provider.HTTP
+	data *provider.Data
+
+	mu   sync.Mutex
+	docs map[string]*document // by URI
+}
+
+// newLoader creates a loader for the documents under the directory
+// `root`. If `root` is empty, local files cannot be loaded.
+func newLoader(root string) *loader {
+	options := []provider.Option{
+		provider.WithOrderedObjects(true),
+		provider.WithUseNumber(true),
+		provider.WithPositions(true),
+	}
+	l := &loader{
+		root: root,
+		http: provider.NewHTTP(options...),
+		data: provider.NewData(options...),
+		docs: make(map[string]*document),
+	}
+	if root != "" {
+		l.fs = provider.NewFS(root, options...)
+	}
+	return l
+}
+
+// Get implements jsref.Provider
+func (l *loader) Get(u *url.URL) (interface{}, error) {
+	doc, err := l.load(u.String())
+	if err != nil {
+		return nil, err
+	}
+	return doc.value, nil
+}
+
+// load returns the document at `uri`, loading it if necessary
+func (l *loader) load(uri string) (*document, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if doc, ok := l.docs[uri]; ok {
+		return doc, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse URI %q", uri)
+	}
+
+	doc := &document{uri: uri}
+	switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+	case ".yaml", ".yml":
+		src, err := l.read(u)
+		if err != nil {
+			return nil, err
+		}
+		jsonbuf, idx, err := jsondoc.YAMLToJSON(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse YAML document %s", l.display(uri))
+		}
+		// Decode into the same types that the providers use for JSON
+		// documents
+		dec := json.NewDecoder(bytes.NewReader(jsonbuf))
+		dec.UseNumber()
+		doc.value, err = jsondoc.DecodeOrdered(dec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse YAML document %s", l.display(uri))
+		}
+		doc.positions = idx.Lookup
+	default:
+		var p interface {
+			jsref.Provider
+			jsref.PositionProvider
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "file":
+			if l.fs == nil {
+				return nil, errors.Errorf("local files may not be loaded: %s", uri)
+			}
+			p = l.fs
+		case "http", "https":
+			p = l.http
+		case "data":
+			p = l.data
+		default:
+			return nil, errors.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		doc.value, err = p.Get(u)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load %s", l.display(uri))
+		}
+		if idx, ok := p.Positions(u); ok {
+			doc.positions = idx.Lookup
+		}
+	}
+
+	if err := doc.absolutize(); err != nil {
+		return nil, errors.Wrapf(err, "invalid reference in %s", l.display(uri))
+	}
+	l.docs[uri] = doc
+	return doc, nil
+}
+
+// read returns the source of the document at `u`
+func (l *loader) read(u *url.URL) ([]byte, error) {
+	switch strings.ToLower(u.Scheme) {
+	case "file":
+		if l.fs == nil {
+			return nil, errors.Errorf("local files may not be loaded: %s", u)
+		}
+		// Like the FS provider, never look outside of the root
+		return ioutil.ReadFile(filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+u.Path))))
+	case "http", "https":
+		res, err := l.http.Client.Get(u.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch HTTP resource")
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("failed to fetch %s: %s", u, res.Status)
+		}
+		return ioutil.ReadAll(res.Body)
+	}
+	return nil, errors.Errorf("unsupported scheme %q", u.Scheme)
+}
+
+// display returns the name of `uri` shown to users. Local files are
+// shown as paths, other URIs are left as they are.
+func (l *loader) display(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(u.Scheme, "file") {
+		return uri
+	}
+	s := filepath.Join(l.root, filepath.FromSlash(strings.TrimPrefix(u.Path, "/")))
+	if u.Fragment != "" {
+		s += "#" + u.Fragment
+	}
+	return s
+}
+
+// absolutize records the references in the document, and makes the
+// ones pointing to other documents absolute. References local to the
+// document are kept as they are.
+func (doc *document) absolutize() error {
+	return walkRefs(doc.value, "", func(om *jsref.OrderedMap, ptr, ref string) error {
+		target, err := jsref.ResolveURI(doc.uri, ref)
+		if err != nil {
+			return err
+		}
+		doc.refs = append(doc.refs, reference{Pointer: ptr, Ref: ref, Target: target})
+		if !strings.HasPrefix(ref, "#") {
+			om.Set("$ref", target)
+		}
+		return nil
+	})
+}
+
+// walkRefs calls `fn` for each object within `v` that holds a "$ref"
+// keyword. Documents loaded by the loader only contain
+// `*jsref.OrderedMap` objects.
+func walkRefs(v interface{}, ptr string, fn func(*jsref.OrderedMap, string, string) error) error {
+	switch v := v.(type) {
+	case *jsref.OrderedMap:
+		if x, ok := v.Get("$ref"); ok {
+			if s, ok := x.(string); ok {
+				if err := fn(v, ptr, s); err != nil {
+					return err
+				}
+			}
+		}
+		for _, key := range v.Keys() {
+			child, _ := v.Get(key)
+			if err := walkRefs(child, ptr+"/"+jsref.EscapePointerToken(key), fn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if err := walkRefs(child, ptr+"/"+strconv.Itoa(i), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
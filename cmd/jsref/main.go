@@ -0,0 +1,521 @@
+// Command jsref resolves JSON References in JSON and YAML documents.
+//
+// Usage:
+//
+//	jsref <command> [flags] <file> [arguments]
+//
+// The commands are:
+//
+//	resolve <file> <pointer>  print the value at <pointer>, with references resolved
+//	deref <file>              print the document with every reference replaced
+//	bundle <file>             print an OpenAPI document with external references
+//	                          moved under "#/components"
+//	validate-refs <file>      report the references that cannot be resolved
+//	graph <file>              print the references between documents
+//
+// Documents referenced by relative references are looked up in the
+// directory of <file>, or in the directory given with -root. Documents
+// whose name ends in ".yaml" or ".yml" are read as YAML, others as
+// JSON. <file> may also be a HTTP(s) URL.
+//
+// The exit code is 0 on success, 1 if the document could not be
+// processed or has broken references, and 2 if the command line is
+// invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/openapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError is returned when the command line is invalid
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(f string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(f, args...)}
+}
+
+// errBrokenRefs is returned by validate-refs once the broken
+// references have been reported
+var errBrokenRefs = errors.New("broken references found")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	nargs   int
+	formats []string // the first one is the default
+	run     func(*app, []string) error
+	flags   func(*flag.FlagSet, *app)
+}
+
+var commands = []*command{
+	{
+		name:    "resolve",
+		args:    "<file> <pointer>",
+		summary: "print the value at <pointer>, with references resolved",
+		nargs:   2,
+		formats: []string{"json", "yaml"},
+		run:     (*app).resolve,
+		flags: func(fs *flag.FlagSet, a *app) {
+			fs.BoolVar(&a.recursive, "recursive", true, "resolve the references within the value")
+		},
+	},
+	{
+		name:    "deref",
+		args:    "<file>",
+		summary: "print the document with every reference replaced",
+		nargs:   1,
+		formats: []string{"json", "yaml"},
+		run:     (*app).deref,
+	},
+	{
+		name:    "bundle",
+		args:    "<file>",
+		summary: `print an OpenAPI document with external references moved under "#/components"`,
+		nargs:   1,
+		formats: []string{"json", "yaml"},
+		run:     (*app).bundle,
+	},
+	{
+		name:    "validate-refs",
+		args:    "<file>",
+		summary: "report the references that cannot be resolved",
+		nargs:   1,
+		formats: []string{"text", "json", "yaml"},
+		run:     (*app).validateRefs,
+	},
+	{
+		name:    "graph",
+		args:    "<file>",
+		summary: "print the references between documents",
+		nargs:   1,
+		formats: []string{"dot", "json", "yaml"},
+		run:     (*app).graph,
+		flags: func(fs *flag.FlagSet, a *app) {
+			fs.BoolVar(&a.documents, "documents", false, "only show the references between documents")
+		},
+	},
+}
+
+// app holds the state of a single invocation of the command
+type app struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	// flags
+	output    string
+	root      string
+	recursive bool
+	documents bool
+
+	loader   *loader
+	resolver *jsref.Resolver
+	uri      string // URI of the input document
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments `args`, and returns the
+// exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	a := &app{stdout: stdout, stderr: stderr}
+	err := a.run(args)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errBrokenRefs):
+		return exitFailure
+	}
+
+	fmt.Fprintf(stderr, "jsref: %s\n", err)
+	var uerr *usageError
+	if errors.As(err, &uerr) {
+		fmt.Fprintf(stderr, "Run 'jsref help' for usage.\n")
+		return exitUsage
+	}
+	return exitFailure
+}
+
+func (a *app) run(args []string) error {
+	if len(args) == 0 {
+		a.usage(a.stderr)
+		return usageErrorf("no command given")
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		a.usage(a.stdout)
+		return nil
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == name {
+			cmd = c
+			break
+		}
+	}
+	if cmd == nil {
+		return usageErrorf("unknown command %q", name)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&a.output, "o", cmd.formats[0], "output format: "+strings.Join(cmd.formats, ", "))
+	fs.StringVar(&a.root, "root", "", "directory that documents are looked up in (default: the directory of <file>)")
+	if cmd.flags != nil {
+		cmd.flags(fs, a)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: jsref %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+
+	if fs.NArg() != cmd.nargs {
+		fs.Usage()
+		return usageErrorf("%s expects %d argument(s), got %d", cmd.name, cmd.nargs, fs.NArg())
+	}
+	if !contains(cmd.formats, a.output) {
+		return usageErrorf("unsupported output format %q for %s", a.output, cmd.name)
+	}
+
+	if err := a.setup(fs.Arg(0)); err != nil {
+		return err
+	}
+	return cmd.run(a, fs.Args())
+}
+
+func (a *app) usage(dst io.Writer) {
+	fmt.Fprintf(dst, "usage: jsref <command> [flags] <file> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(dst, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(dst, "\nRun 'jsref <command> -h' for the flags of a command.\n")
+}
+
+// setup prepares the loader and the resolver for the input document
+// `file`
+func (a *app) setup(file string) error {
+	remote := false
+	if u, err := url.Parse(file); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		// Remote documents may not read local files
+		a.uri = u.String()
+		a.loader = newLoader("")
+		remote = true
+	} else {
+		root := a.root
+		if root == "" {
+			root = filepath.Dir(file)
+		}
+		rel, err := relPath(root, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return usageErrorf("%s is not within the root directory %s", file, root)
+		}
+		a.uri = (&url.URL{Scheme: "file", Path: "/" + filepath.ToSlash(rel)}).String()
+		a.loader = newLoader(root)
+	}
+
+	a.resolver = jsref.New()
+	if remote {
+		a.resolver.ReferencePolicy = jsref.SameOriginPolicy
+	}
+	return a.resolver.AddProvider(a.loader)
+}
+
+// input loads the input document
+func (a *app) input() (*document, error) {
+	return a.loader.load(a.uri)
+}
+
+func (a *app) resolve(args []string) error {
+	doc, err := a.input()
+	if err != nil {
+		return err
+	}
+
+	// Lazy resolution follows the references found along the pointer
+	root, err := a.resolver.Resolve(doc.value, "", jsref.WithLazyResolution(true), jsref.WithBaseURI(a.uri))
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve document")
+	}
+	ptr := args[1]
+	x, err := jsref.EvalPointer(root, ptr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %s", ptr)
+	}
+
+	var v interface{}
+	switch x := x.(type) {
+	case *jsref.Node:
+		if !a.recursive {
+			v = x.Value()
+			break
+		}
+		v, err = x.Expand()
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve %s", ptr)
+		}
+	default:
+		v = x
+	}
+	return encode(a.stdout, a.output, v)
+}
+
+func (a *app) deref(_ []string) error {
+	doc, err := a.input()
+	if err != nil {
+		return err
+	}
+
+	var v interface{}
+	if isOpenAPI(doc.value) {
+		v, err = openapi.New(a.resolver).Dereference(doc.value, openapi.WithBaseURI(a.uri))
+	} else {
+		v, err = a.resolver.Resolve(doc.value, "", jsref.WithRecursiveResolution(true), jsref.WithBaseURI(a.uri))
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to dereference document")
+	}
+	return encode(a.stdout, a.output, v)
+}
+
+func (a *app) bundle(_ []string) error {
+	doc, err := a.input()
+	if err != nil {
+		return err
+	}
+	if !isOpenAPI(doc.value) {
+		return errors.New("bundle only supports OpenAPI documents")
+	}
+
+	v, err := openapi.New(a.resolver).Bundle(doc.value, openapi.WithBaseURI(a.uri))
+	if err != nil {
+		return errors.Wrap(err, "failed to bundle document")
+	}
+	return encode(a.stdout, a.output, v)
+}
+
+// problem is a reference that cannot be resolved
+type problem struct {
+	Document string `json:"document"`
+	Pointer  string `json:"pointer"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Ref      string `json:"ref"`
+	Error    string `json:"error"`
+}
+
+func (p problem) String() string {
+	where := p.Document + "#" + p.Pointer
+	if p.Line > 0 {
+		where = fmt.Sprintf("%s:%d:%d", p.Document, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s: broken reference %q: %s", where, p.Ref, p.Error)
+}
+
+func (a *app) validateRefs(_ []string) error {
+	problems := []problem{}
+	err := a.walk(func(doc *document, ref reference) error {
+		_, err := a.resolver.Resolve(map[string]interface{}{"$ref": ref.Target}, "")
+		if err == nil {
+			return nil
+		}
+
+		// The location of the reference is already known
+		var rerr *jsref.RefError
+		if errors.As(err, &rerr) {
+			err = rerr.Err
+		}
+		p := problem{
+			Document: a.loader.display(doc.uri),
+			Pointer:  ref.Pointer,
+			Ref:      ref.Ref,
+			Error:    err.Error(),
+		}
+		if pos, ok := doc.position(ref.Pointer + "/$ref"); ok {
+			p.Line = pos.Line
+			p.Column = pos.Column
+		}
+		problems = append(problems, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if a.output == "text" {
+		for _, p := range problems {
+			fmt.Fprintln(a.stdout, p)
+		}
+	} else if err := encode(a.stdout, a.output, problems); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(a.stderr, "jsref: %d broken reference(s) found\n", len(problems))
+		return errBrokenRefs
+	}
+	return nil
+}
+
+// edge is a reference from one location to another
+type edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (a *app) graph(_ []string) error {
+	edges := []edge{}
+	seen := make(map[edge]struct{})
+	err := a.walk(func(doc *document, ref reference) error {
+		e := edge{
+			From: a.loader.display(doc.uri) + "#" + ref.Pointer,
+			To:   a.loader.display(ref.Target),
+		}
+		if a.documents {
+			e.From = a.loader.display(doc.uri)
+			e.To = a.loader.display(strings.SplitN(ref.Target, "#", 2)[0])
+			if e.From == e.To {
+				return nil
+			}
+		}
+		if _, ok := seen[e]; ok {
+			return nil
+		}
+		seen[e] = struct{}{}
+		edges = append(edges, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if a.output != "dot" {
+		return encode(a.stdout, a.output, edges)
+	}
+
+	fmt.Fprintln(a.stdout, "digraph refs {")
+	for _, e := range edges {
+		fmt.Fprintf(a.stdout, "  %q -> %q;\n", e.From, e.To)
+	}
+	fmt.Fprintln(a.stdout, "}")
+	return nil
+}
+
+// walk calls `fn` for each reference in the input document, and in
+// the documents that can be reached from it
+func (a *app) walk(fn func(*document, reference) error) error {
+	doc, err := a.input()
+	if err != nil {
+		return err
+	}
+
+	visited := map[string]struct{}{doc.uri: {}}
+	queue := []*document{doc}
+	for len(queue) > 0 {
+		doc := queue[0]
+		queue = queue[1:]
+		for _, ref := range doc.refs {
+			if err := fn(doc, ref); err != nil {
+				return err
+			}
+
+			uri := strings.SplitN(ref.Target, "#", 2)[0]
+			if _, ok := visited[uri]; ok {
+				continue
+			}
+			visited[uri] = struct{}{}
+			// Documents that cannot be loaded, or that may not be
+			// referenced, are reported by `fn`
+			if !a.allowed(doc.uri, uri) {
+				continue
+			}
+			if next, err := a.loader.load(uri); err == nil {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// allowed returns true if the resolver's ReferencePolicy allows the
+// document at `origin` to reference the document at `target`
+func (a *app) allowed(origin, target string) bool {
+	if a.resolver.ReferencePolicy == nil {
+		return true
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	t, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return a.resolver.ReferencePolicy.CheckReference(o, t) == nil
+}
+
+// relPath returns the path of `file` relative to `root`, which may be
+// given either as absolute or relative paths
+func relPath(root, file string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(root, file)
+}
+
+func isOpenAPI(v interface{}) bool {
+	om, ok := v.(*jsref.OrderedMap)
+	if !ok {
+		return false
+	}
+	_, ok = om.Get("openapi")
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates the files in `files` under a temporary directory,
+// and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommand(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"api.yaml": `openapi: 3.0.3
+info:
+  title: pets
+  version: "1"
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: schemas/pet.json#/Pet
+`,
+		"schemas/pet.json": `{
+  "Pet": {
+    "type": "object",
+    "properties": {
+      "tag": {"$ref": "tag.yaml"},
+      "age": {"$ref": "#/Age"}
+    }
+  },
+  "Age": {"type": "integer", "minimum": 0}
+}`,
+		"schemas/tag.yaml": "type: string\n",
+		"broken.json": `{
+  "a": {"$ref": "#/missing"},
+  "b": {"$ref": "schemas/nothere.json"},
+  "c": {"$ref": "schemas/pet.json#/Age"}
+}`,
+	})
+	api := filepath.Join(dir, "api.yaml")
+	broken := filepath.Join(dir, "broken.json")
+
+	t.Run("resolve", func(t *testing.T) {
+		code, stdout, stderr := runCommand("resolve", "-o", "yaml", api, "/paths/~1pets/get/responses/200/content/application~1json/schema/properties")
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Equal(t, "tag:\n  type: string\nage:\n  type: integer\n  minimum: 0\n", stdout) {
+			return
+		}
+	})
+	t.Run("resolve without recursion", func(t *testing.T) {
+		code, stdout, stderr := runCommand("resolve", "-recursive=false", filepath.Join(dir, "schemas", "pet.json"), "#/Pet/properties")
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.JSONEq(t, `{"tag": {"$ref": "file:///tag.yaml"}, "age": {"$ref": "#/Age"}}`, stdout) {
+			return
+		}
+	})
+	t.Run("deref", func(t *testing.T) {
+		code, stdout, stderr := runCommand("deref", api)
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Contains(t, stdout, `"tag": {
+                      "type": "string"
+                    }`) {
+			return
+		}
+		if !assert.NotContains(t, stdout, "$ref") {
+			return
+		}
+	})
+	t.Run("bundle", func(t *testing.T) {
+		code, stdout, stderr := runCommand("bundle", "-o", "yaml", api)
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Contains(t, stdout, "$ref: '#/components/schemas/Pet'") {
+			return
+		}
+		if !assert.Contains(t, stdout, "components:\n  schemas:\n") {
+			return
+		}
+	})
+	t.Run("bundle requires OpenAPI", func(t *testing.T) {
+		code, _, stderr := runCommand("bundle", broken)
+		if !assert.Equal(t, exitFailure, code) {
+			return
+		}
+		if !assert.Contains(t, stderr, "only supports OpenAPI documents") {
+			return
+		}
+	})
+	t.Run("validate-refs", func(t *testing.T) {
+		code, stdout, stderr := runCommand("validate-refs", api)
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Empty(t, stdout) {
+			return
+		}
+
+		code, stdout, stderr = runCommand("validate-refs", broken)
+		if !assert.Equal(t, exitFailure, code) {
+			return
+		}
+		if !assert.Contains(t, stdout, broken+`:2:17: broken reference "#/missing"`) {
+			return
+		}
+		if !assert.Contains(t, stdout, broken+`:3:17: broken reference "schemas/nothere.json"`) {
+			return
+		}
+		if !assert.NotContains(t, stdout, `"schemas/pet.json#/Age"`) {
+			return
+		}
+		if !assert.Contains(t, stderr, "2 broken reference(s) found") {
+			return
+		}
+
+		code, stdout, _ = runCommand("validate-refs", "-o", "json", broken)
+		if !assert.Equal(t, exitFailure, code) {
+			return
+		}
+		if !assert.Contains(t, stdout, `"pointer": "/a"`) {
+			return
+		}
+	})
+	t.Run("graph", func(t *testing.T) {
+		code, stdout, stderr := runCommand("graph", "-documents", "-root", dir, api)
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		expected := "digraph refs {\n" +
+			"  \"" + api + "\" -> \"" + filepath.Join(dir, "schemas", "pet.json") + "\";\n" +
+			"  \"" + filepath.Join(dir, "schemas", "pet.json") + "\" -> \"" + filepath.Join(dir, "schemas", "tag.yaml") + "\";\n" +
+			"}\n"
+		if !assert.Equal(t, expected, stdout) {
+			return
+		}
+
+		code, stdout, stderr = runCommand("graph", "-o", "json", filepath.Join(dir, "schemas", "pet.json"))
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Contains(t, stdout, `"to": "`+filepath.Join(dir, "schemas", "pet.json")+`#/Age"`) {
+			return
+		}
+	})
+	t.Run("YAML aliases", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"recursive.yaml": "a: &x\n  b: *x\n",
+			"laughs.yaml": `a: &a ["lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol"]
+b: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a]
+c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b]
+d: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c]
+e: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d]
+f: &f [*e, *e, *e, *e, *e, *e, *e, *e, *e]
+g: &g [*f, *f, *f, *f, *f, *f, *f, *f, *f]
+h: &h [*g, *g, *g, *g, *g, *g, *g, *g, *g]
+i: &i [*h, *h, *h, *h, *h, *h, *h, *h, *h]
+`,
+		})
+		for name, msg := range map[string]string{
+			"recursive.yaml": "refers to itself",
+			"laughs.yaml":    "too large",
+		} {
+			code, _, stderr := runCommand("deref", filepath.Join(dir, name))
+			if !assert.Equal(t, exitFailure, code, "%s should fail", name) {
+				return
+			}
+			if !assert.Contains(t, stderr, msg, "%s should be rejected", name) {
+				return
+			}
+		}
+	})
+	t.Run("remote input", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api.json":
+				w.Write([]byte(`{"pet": {"$ref": "pet.json"}, "local": {"$ref": "file:///schemas/pet.json"}}`))
+			case "/pet.json":
+				w.Write([]byte(`{"type": "object"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		// Local files are never read, even under the root directory
+		code, _, stderr := runCommand("deref", "-root", dir, srv.URL+"/api.json")
+		if !assert.Equal(t, exitFailure, code, "deref should fail") {
+			return
+		}
+		if !assert.Contains(t, stderr, "file:///schemas/pet.json", "the reference to a local file should be reported") {
+			return
+		}
+
+		code, stdout, stderr := runCommand("graph", "-o", "json", srv.URL+"/api.json")
+		if !assert.Equal(t, exitOK, code, "exit code should be 0: %s", stderr) {
+			return
+		}
+		if !assert.Contains(t, stdout, srv.URL+"/pet.json", "same origin references should be followed") {
+			return
+		}
+	})
+	t.Run("usage errors", func(t *testing.T) {
+		for _, args := range [][]string{
+			{},
+			{"unknown"},
+			{"deref"},
+			{"deref", "-o", "dot", api},
+			{"resolve", api},
+			{"deref", "-root", filepath.Join(dir, "schemas"), api},
+		} {
+			code, _, _ := runCommand(args...)
+			if !assert.Equal(t, exitUsage, code, "%q should be a usage error", args) {
+				return
+			}
+		}
+
+		code, stdout, _ := runCommand("help")
+		if !assert.Equal(t, exitOK, code) {
+			return
+		}
+		if !assert.Contains(t, stdout, "validate-refs") {
+			return
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// encode writes `v` to `dst` in the given format, "json" or "yaml"
+func encode(dst io.Writer, format string, v interface{}) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(dst)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		node, err := toYAML(v)
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(dst)
+		enc.SetIndent(2)
+		if err := enc.Encode(node); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return errors.Errorf("unsupported output format %q", format)
+}
+
+// toYAML converts `v` to a YAML node, preserving the order of the keys
+// of `*jsref.OrderedMap` objects
+func toYAML(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	case *jsref.OrderedMap:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range v.Keys() {
+			child, _ := v.Get(key)
+			if err := appendPair(node, key, child); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			if err := appendPair(node, key, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, elem := range v {
+			child, err := toYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(v), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+	}
+
+	// Anything else is converted through its JSON representation
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %T to YAML", v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	x, err := jsref.DecodeOrdered(dec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %T to YAML", v)
+	}
+	return toYAML(x)
+}
+
+func appendPair(node *yaml.Node, key string, v interface{}) error {
+	child, err := toYAML(v)
+	if err != nil {
+		return err
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+	return nil
+}
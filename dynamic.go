@@ -0,0 +1,266 @@
+package jsref
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scopeEntry is a document in the dynamic scope of a resolution.
+// Every time a reference leads into a document fetched from one
+// of the providers, that document is pushed onto the scope.
+type scopeEntry struct {
+	uri    string
+	object interface{}
+}
+
+// rootReferencer is implemented by KeywordHandlers that need to be
+// called for references to "#", which are otherwise skipped
+type rootReferencer interface {
+	allowRootReference() bool
+}
+
+func allowsRootReference(h KeywordHandler) bool {
+	rr, ok := h.(rootReferencer)
+	return ok && rr.allowRootReference()
+}
+
+// DynamicRef is the KeywordHandler that implements "$dynamicRef" as
+// defined by JSON Schema 2020-12. Register it with
+//
+//	r.AddKeyword("$dynamicRef", jsref.DynamicRef)
+//
+// The reference is first resolved like a regular "$ref". If it points
+// to an anchor, and the object it resolves to declares the same name
+// as its "$dynamicAnchor", the dynamic scope is searched from the
+// outermost document inwards, and the first document that declares
+// the "$dynamicAnchor" is used instead.
+//
+// The dynamic scope is made of the document passed to `Resolve` and
+// every document that was entered by following a reference to reach
+// the "$dynamicRef". Resources embedded using "$id" are not tracked.
+var DynamicRef KeywordHandler = dynamicRef{}
+
+// RecursiveRef is the KeywordHandler that implements "$recursiveRef"
+// as defined by JSON Schema 2019-09. Register it with
+//
+//	r.AddKeyword("$recursiveRef", jsref.RecursiveRef)
+//
+// The reference must be "#". If the root of the current document has
+// "$recursiveAnchor" set to true, the dynamic scope (see DynamicRef)
+// is searched from the outermost document inwards, and the first
+// document whose root has "$recursiveAnchor" set to true is used.
+// Otherwise the reference resolves to the root of the current document.
+var RecursiveRef KeywordHandler = recursiveRef{}
+
+type dynamicRef struct{}
+
+func (dynamicRef) ResolveReference(rctx *ReferenceContext, ref string) (interface{}, error) {
+	target, err := rctx.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.IndexByte(ref, '#')
+	if i < 0 {
+		return target, nil
+	}
+	anchor := ref[i+1:]
+	if anchor == "" || anchor[0] == '/' {
+		return target, nil
+	}
+
+	if s, ok := objectString(target, "$dynamicAnchor"); !ok || s != anchor {
+		return target, nil
+	}
+
+	for i, entry := range rctx.ctx.scope {
+		doc, err := scopeDocument(rctx.ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := findAnchorKeyword(doc, "$dynamicAnchor", anchor); ok {
+			return resolveInScope(rctx.ctx, rctx.r, i, doc, "#"+anchor)
+		}
+	}
+	return target, nil
+}
+
+type recursiveRef struct{}
+
+func (recursiveRef) allowRootReference() bool {
+	return true
+}
+
+func (recursiveRef) ResolveReference(rctx *ReferenceContext, ref string) (interface{}, error) {
+	if ref != "#" {
+		return nil, errors.Errorf("$recursiveRef must be '#', got %q", ref)
+	}
+
+	target, err := evalptr(rctx.ctx, rctx.r, rctx.ctx.object, "#")
+	if err != nil {
+		return nil, err
+	}
+
+	if !isRecursiveAnchor(target) {
+		return expandRoot(rctx.ctx, rctx.r, rctx.ctx.docURI, target)
+	}
+
+	for i, entry := range rctx.ctx.scope {
+		doc, err := scopeDocument(rctx.ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+		if isRecursiveAnchor(doc) {
+			v, err := resolveInScope(rctx.ctx, rctx.r, i, doc, "#")
+			if err != nil {
+				return nil, err
+			}
+			return expandRoot(rctx.ctx, rctx.r, entry.uri, v)
+		}
+	}
+	return expandRoot(rctx.ctx, rctx.r, rctx.ctx.docURI, target)
+}
+
+// expandRoot expands the references within `v`, the root of the
+// document at `uri`, when resolving recursively. As expandRef does
+// for external documents, this is done while the root is marked as
+// seen, so that reaching a "$recursiveRef" to the same root again is
+// reported as a loop instead of being expanded forever.
+func expandRoot(ctx *resolveCtx, r *Resolver, uri string, v interface{}) (interface{}, error) {
+	if !ctx.recursive {
+		return v, nil
+	}
+
+	ref := uri + "#"
+	err := ctx.enter(r, ref)
+	defer func() { ctx.rlevel-- }()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx2 := &resolveCtx{}
+	*ctx2 = *ctx
+	ctx2.seen = append(append([]string{}, ctx.seen...), ref)
+	ctx2.path = append([]string{}, ctx.path...)
+	ctx2.trail = append([]trailEntry{}, ctx.trail...)
+	v, err = traverseExpandRefRecursive(ctx2, r, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to traverse recursive reference")
+	}
+	return v, nil
+}
+
+func isRecursiveAnchor(v interface{}) bool {
+	x, ok := objectValue(v, "$recursiveAnchor")
+	if !ok {
+		return false
+	}
+	b, ok := x.(bool)
+	return ok && b
+}
+
+// scopeDocument returns the document in a scope entry, decoding it
+// if it's raw JSON
+func scopeDocument(ctx *resolveCtx, entry scopeEntry) (interface{}, error) {
+	if raw, ok := entry.object.(json.RawMessage); ok {
+		return decodeRaw(ctx, raw)
+	}
+	return entry.object, nil
+}
+
+// resolveInScope evaluates `ptr` against the document at position `i`
+// of the dynamic scope, as if the resolution had just entered it
+func resolveInScope(ctx *resolveCtx, r *Resolver, i int, doc interface{}, ptr string) (interface{}, error) {
+	ctx2 := &resolveCtx{}
+	*ctx2 = *ctx
+	ctx2.object = doc
+	ctx2.scope = append([]scopeEntry{}, ctx.scope[:i+1]...)
+	ctx2.docURI = ctx.scope[i].uri
+	ctx2.inRoot = i == 0
+	v, err := evalptr(ctx2, r, doc, ptr)
+	ctx.located = ctx2.located
+	ctx.holder = ctx2.holder
+	return v, err
+}
+
+// findAnchor looks for an object in `v` that declares `name` as
+// its anchor, using either "$anchor", "$dynamicAnchor", or the
+// pre 2019-09 form of "$id": "#name"
+func findAnchor(v interface{}, name string) (interface{}, bool) {
+	if x, ok := findAnchorKeyword(v, "$anchor", name); ok {
+		return x, true
+	}
+	if x, ok := findAnchorKeyword(v, "$dynamicAnchor", name); ok {
+		return x, true
+	}
+	return findAnchorKeyword(v, "$id", "#"+name)
+}
+
+// findAnchorKeyword walks `v` depth first, looking for an object
+// whose `keyword` is set to `name`
+func findAnchorKeyword(v interface{}, keyword, name string) (interface{}, bool) {
+	if s, ok := objectString(v, keyword); ok && s == name {
+		return v, true
+	}
+
+	if om, ok := v.(*OrderedMap); ok {
+		for _, key := range om.Keys() {
+			child, _ := om.Get(key)
+			if x, ok := findAnchorKeyword(child, keyword, name); ok {
+				return x, true
+			}
+		}
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		// Sort the keys, so that the same object is found on each run
+		// when an anchor is declared more than once
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return mapKeyToken(keys[i]) < mapKeyToken(keys[j]) })
+		for _, key := range keys {
+			if x, ok := findAnchorKeyword(rv.MapIndex(key).Interface(), keyword, name); ok {
+				return x, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if x, ok := findAnchorKeyword(rv.Index(i).Interface(), keyword, name); ok {
+				return x, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// objectValue returns the value associated with `key` in the object `v`
+func objectValue(v interface{}, key string) (interface{}, bool) {
+	if om, ok := v.(*OrderedMap); ok {
+		return om.Get(key)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	x := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+	if !x.IsValid() {
+		return nil, false
+	}
+	return x.Interface(), true
+}
+
+func objectString(v interface{}, key string) (string, bool) {
+	x, ok := objectValue(v, key)
+	if !ok {
+		return "", false
+	}
+	s, ok := x.(string)
+	return s, ok
+}
@@ -0,0 +1,55 @@
+package jsref
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// RefError is returned by `Resolve` when a reference could not be
+// resolved. It describes where the offending reference is located.
+type RefError struct {
+	// Keyword is the keyword that holds the reference, such as "$ref"
+	Keyword string
+	// Ref is the reference that could not be resolved
+	Ref string
+	// Location is the location of the object that holds the reference.
+	// Its Position, if known, points to the value of the keyword.
+	Location Location
+	// Err is the reason why the reference could not be resolved
+	Err error
+}
+
+func (e *RefError) Error() string {
+	where := e.Location.String()
+	if e.Location.Position.IsValid() {
+		where = e.Location.Document + ":" + e.Location.Position.String()
+	}
+	return fmt.Sprintf("failed to expand ref %q at %s: %s", e.Ref, where, e.Err)
+}
+
+func (e *RefError) Unwrap() error {
+	return e.Err
+}
+
+// newRefError reports that `ref` could not be resolved. Only the
+// innermost reference is reported as a RefError.
+func newRefError(ctx *resolveCtx, keyword, ref string, loc *Location, err error) error {
+	if loc == locatedHere {
+		loc = ctx.here()
+	}
+
+	var rerr *RefError
+	if errors.As(err, &rerr) || loc == nil {
+		return errors.Wrap(err, "failed to expand ref")
+	}
+
+	l := *loc
+	l.Position = ctx.positions.position(l, keyword)
+	return &RefError{
+		Keyword:  keyword,
+		Ref:      ref,
+		Location: l,
+		Err:      err,
+	}
+}
@@ -0,0 +1,131 @@
+package jsref
+
+import (
+	"net/url"
+	"time"
+)
+
+// EventKind identifies the kind of an Event
+type EventKind int
+
+const (
+	// EventRefFound is emitted when a reference is found in a value
+	// and is about to be resolved
+	EventRefFound EventKind = iota
+	// EventFetchStart is emitted before a document is requested from
+	// a provider
+	EventFetchStart
+	// EventFetchEnd is emitted after a provider returns, whether it
+	// succeeded or not. Duration holds the time spent in the provider
+	EventFetchEnd
+	// EventProviderHit is emitted when a provider returns a document
+	EventProviderHit
+	// EventProviderMiss is emitted when a provider fails to return a
+	// document. The next provider, if any, is tried afterwards
+	EventProviderMiss
+	// EventPointerFailed is emitted when a JSON pointer or an anchor
+	// could not be evaluated against a document
+	EventPointerFailed
+	// EventLoopDetected is emitted when a reference loop is detected
+	EventLoopDetected
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRefFound:
+		return "ref-found"
+	case EventFetchStart:
+		return "fetch-start"
+	case EventFetchEnd:
+		return "fetch-end"
+	case EventProviderHit:
+		return "provider-hit"
+	case EventProviderMiss:
+		return "provider-miss"
+	case EventPointerFailed:
+		return "pointer-failed"
+	case EventLoopDetected:
+		return "loop-detected"
+	}
+	return "unknown"
+}
+
+// Event describes something that happened during resolution. Fields
+// that do not apply to the kind of the event are left empty.
+type Event struct {
+	Kind EventKind
+	// Keyword is the keyword that holds the reference, such as "$ref"
+	Keyword string
+	// Ref is the reference being resolved, or the JSON pointer that
+	// failed for EventPointerFailed
+	Ref string
+	// URL is the URL of the document requested from Provider
+	URL *url.URL
+	// Provider is the provider the document was requested from
+	Provider Provider
+	// Document is the URI of the document the event relates to
+	Document string
+	// Duration is the time spent in the provider, for EventFetchEnd
+	Duration time.Duration
+	// Err is the error that caused the event, if any
+	Err error
+}
+
+// Hook receives the events emitted by a Resolver. Hooks are called
+// synchronously, and must be safe for concurrent use if the Resolver
+// is used from several goroutines.
+type Hook interface {
+	HandleEvent(*Event)
+}
+
+// HookFunc is a function that implements Hook
+type HookFunc func(*Event)
+
+// HandleEvent calls f(ev)
+func (f HookFunc) HandleEvent(ev *Event) {
+	f(ev)
+}
+
+// AddHook registers a hook that receives the events emitted while
+// resolving references
+func (r *Resolver) AddHook(h Hook) error {
+	r.hooks = append(r.hooks, h)
+	return nil
+}
+
+func (r *Resolver) hasHooks() bool {
+	return len(r.hooks) > 0
+}
+
+func (r *Resolver) emit(ev *Event) {
+	for _, h := range r.hooks {
+		h.HandleEvent(ev)
+	}
+}
+
+// fetch requests the document at `u` from `p`, emitting the
+// corresponding events
+func fetch(ctx *resolveCtx, r *Resolver, p Provider, u *url.URL, ref string) (interface{}, error) {
+	if !r.hasHooks() {
+		return p.Get(u)
+	}
+
+	r.emit(&Event{Kind: EventFetchStart, Ref: ref, URL: u, Provider: p, Document: ctx.docURI})
+	start := time.Now()
+	v, err := p.Get(u)
+	r.emit(&Event{Kind: EventFetchEnd, Ref: ref, URL: u, Provider: p, Document: ctx.docURI, Duration: time.Since(start), Err: err})
+	if err != nil {
+		r.emit(&Event{Kind: EventProviderMiss, Ref: ref, URL: u, Provider: p, Document: ctx.docURI, Err: err})
+	} else {
+		r.emit(&Event{Kind: EventProviderHit, Ref: ref, URL: u, Provider: p, Document: ctx.docURI})
+	}
+	return v, err
+}
+
+// pointerFailed emits EventPointerFailed, and returns `err`
+func pointerFailed(ctx *resolveCtx, r *Resolver, ptr string, err error) error {
+	if r.hasHooks() {
+		r.emit(&Event{Kind: EventPointerFailed, Ref: "#" + ptr, Document: ctx.docURI, Err: err})
+	}
+	return err
+}
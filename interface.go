@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/url"
 	"reflect"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
 )
 
 var zeroval = reflect.Value{}
@@ -11,11 +13,35 @@ var zeroval = reflect.Value{}
 var ErrMaxRecursion = errors.New("reached max number of recursions")
 var ErrReferenceLoop = errors.New("reference loop detected")
 
+// ErrLimitExceeded is matched by all LimitErrors when using errors.Is
+var ErrLimitExceeded = jsondoc.ErrLimitExceeded
+
+// ErrTypeMismatch is matched by all TypeErrors when using errors.Is
+var ErrTypeMismatch = errors.New("resolved value does not match the requested type")
+
+// ErrIntegrity is matched by all IntegrityErrors when using errors.Is
+var ErrIntegrity = errors.New("document does not match the lockfile")
+
+// ErrPolicyViolation is matched by the errors reported when a request
+// or a reference is denied by a policy, when using errors.Is
+var ErrPolicyViolation = jsondoc.ErrPolicyViolation
+
 // Resolver is responsible for interpreting the provided JSON
 // reference.
 type Resolver struct {
 	providers     []Provider
+	keywords      []*keyword
+	hooks         []Hook
 	MaxRecursions int
+	// SiblingPolicy specifies how keys next to "$ref" are treated.
+	// The default, IgnoreSiblings, discards them.
+	SiblingPolicy SiblingPolicy
+	// Limits caps the work done by each call to Resolve. By default
+	// only MaxRecursions applies.
+	Limits Limits
+	// ReferencePolicy decides which references to external documents
+	// may be followed. By default, any reference may be followed.
+	ReferencePolicy ReferencePolicy
 }
 
 // Provider resolves a URL into a ... thing.
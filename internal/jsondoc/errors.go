@@ -0,0 +1,35 @@
+package jsondoc
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPolicyViolation is matched by the errors reported when a request
+// or a reference is denied by a policy. It is exported by the jsref
+// package, and shared with the providers so that they can report such
+// errors without importing jsref.
+var ErrPolicyViolation = errors.New("denied by policy")
+
+// ErrLimitExceeded is matched by all LimitErrors. It is exported by
+// the jsref package.
+var ErrLimitExceeded = errors.New("resolution limit exceeded")
+
+// LimitError is returned when a limit on the work done or on the size
+// of the documents is exceeded. It is exported by the jsref package.
+type LimitError struct {
+	// Limit is the name of the limit: "references", "documents",
+	// "bytes" or "nodes"
+	Limit string
+	// Max is the configured value of the limit
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: more than %d %s", ErrLimitExceeded, e.Max, e.Limit)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
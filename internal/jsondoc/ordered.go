@@ -0,0 +1,183 @@
+// Package jsondoc holds the representation of decoded JSON documents
+// that is shared by the resolver and the providers. Its types are
+// exported by the jsref package.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// OrderedMap is a JSON object that remembers the order in which its
+// keys appeared in the source document. It is understood by `jsref.Resolver`
+// wherever a `map[string]interface{}` would be, and when marshaled
+// back to JSON the keys are written in their original order.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewOrderedMap creates a new empty OrderedMap
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{
+		values: make(map[string]interface{}),
+	}
+}
+
+// Len returns the number of keys in the object
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys of the object, in order
+func (m *OrderedMap) Keys() []string {
+	return append([]string(nil), m.keys...)
+}
+
+// Get returns the value associated with `key`
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Set associates `v` with `key`. If `key` is new, it is appended
+// after the existing keys. Otherwise the key keeps its position.
+func (m *OrderedMap) Set(key string, v interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+// Delete removes `key` from the object
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// JSONGet allows JSON pointers to be evaluated against OrderedMap
+func (m *OrderedMap) JSONGet(tok string) (interface{}, error) {
+	v, ok := m.values[tok]
+	if !ok {
+		return nil, errors.Errorf("key %q not found", tok)
+	}
+	return v, nil
+}
+
+// MarshalJSON encodes the object, writing the keys in order
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal key %q", key)
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal value for key %q", key)
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object, preserving the order of its
+// keys. Nested objects are decoded as OrderedMap as well.
+func (m *OrderedMap) UnmarshalJSON(data []byte) error {
+	v, err := DecodeOrdered(json.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+
+	om, ok := v.(*OrderedMap)
+	if !ok {
+		return errors.New("JSON value is not an object")
+	}
+	*m = *om
+	return nil
+}
+
+// DecodeOrdered decodes the next JSON value from `dec`, using
+// OrderedMap for objects instead of `map[string]interface{}`.
+// Numbers are decoded as `json.Number` if `dec.UseNumber()` was
+// called, and as float64 otherwise.
+func DecodeOrdered(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read JSON token")
+	}
+
+	delim, ok := t.(json.Delim)
+	if !ok {
+		return t, nil
+	}
+
+	switch delim {
+	case '{':
+		m := NewOrderedMap()
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read JSON object key")
+			}
+			v, err := DecodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(kt.(string), v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, errors.Wrap(err, "failed to read end of JSON object")
+		}
+		return m, nil
+	case '[':
+		l := []interface{}{}
+		for dec.More() {
+			v, err := DecodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, errors.Wrap(err, "failed to read end of JSON array")
+		}
+		return l, nil
+	}
+	return nil, errors.Errorf("unexpected JSON delimiter %q", delim)
+}
+
+// Decode decodes a single JSON value from `dec` according to the
+// given settings
+func Decode(dec *json.Decoder, useNumber, ordered bool) (interface{}, error) {
+	if useNumber {
+		dec.UseNumber()
+	}
+
+	if ordered {
+		return DecodeOrdered(dec)
+	}
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
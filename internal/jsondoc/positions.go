@@ -0,0 +1,159 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Position is a location within the source of a JSON document.
+// Line and Column start at 1, and Column counts characters, not
+// bytes. Offset is the byte offset from the start of the document.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// IsValid returns true if the position is known
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position in the form "line:column"
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// PositionIndex maps the JSON pointers of the values in a document
+// to their position in the source of the document.
+type PositionIndex struct {
+	positions map[string]Position
+}
+
+// IndexPositions scans the JSON document in `src`, and records the
+// position where each of its values start.
+func IndexPositions(src []byte) (*PositionIndex, error) {
+	s := &positionScanner{
+		src: src,
+		dec: json.NewDecoder(bytes.NewReader(src)),
+		idx: &PositionIndex{positions: make(map[string]Position)},
+		pos: Position{Line: 1, Column: 1},
+	}
+	s.dec.UseNumber()
+
+	if err := s.scan(""); err != nil {
+		return nil, errors.Wrap(err, "failed to index positions")
+	}
+	return s.idx, nil
+}
+
+// Lookup returns the position of the value at the JSON pointer `ptr`
+func (idx *PositionIndex) Lookup(ptr string) (Position, bool) {
+	if idx == nil {
+		return Position{}, false
+	}
+	if len(ptr) > 0 && ptr[0] == '#' {
+		ptr = ptr[1:]
+	}
+	pos, ok := idx.positions[ptr]
+	return pos, ok
+}
+
+// Len returns the number of values in the index
+func (idx *PositionIndex) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.positions)
+}
+
+type positionScanner struct {
+	src []byte
+	dec *json.Decoder
+	idx *PositionIndex
+	pos Position // position of pos.Offset
+}
+
+// advance moves the current position to the start of the next value,
+// skipping white space and separators
+func (s *positionScanner) advance() {
+	off := int(s.dec.InputOffset())
+	for ; s.pos.Offset < off; s.pos.Offset++ {
+		s.step()
+	}
+	for s.pos.Offset < len(s.src) {
+		switch s.src[s.pos.Offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			s.step()
+			s.pos.Offset++
+			continue
+		}
+		return
+	}
+}
+
+// step accounts for the byte at the current offset
+func (s *positionScanner) step() {
+	c := s.src[s.pos.Offset]
+	switch {
+	case c == '\n':
+		s.pos.Line++
+		s.pos.Column = 1
+	case utf8.RuneStart(c):
+		s.pos.Column++
+	}
+}
+
+func (s *positionScanner) scan(ptr string) error {
+	s.advance()
+	s.idx.positions[ptr] = s.pos
+
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for s.dec.More() {
+			tok, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, ok := tok.(string)
+			if !ok {
+				return errors.Errorf("expected object key at offset %d", s.dec.InputOffset())
+			}
+			if err := s.scan(ptr + "/" + escapePointerToken(key)); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; s.dec.More(); i++ {
+			if err := s.scan(ptr + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	// Consume the closing delimiter
+	_, err = s.dec.Token()
+	return err
+}
+
+func escapePointerToken(tok string) string {
+	if strings.IndexAny(tok, "~/") < 0 {
+		return tok
+	}
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(tok)
+}
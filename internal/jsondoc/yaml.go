@@ -0,0 +1,134 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// maxYAMLNodes caps the number of values produced when converting a
+// YAML document, as aliases can make a small document expand
+// exponentially
+const maxYAMLNodes = 1 << 20
+
+// YAMLToJSON converts the YAML document in `src` to JSON, preserving
+// the order of the keys of mappings. The position of each value in
+// `src` is recorded in the returned index, which has no offsets.
+//
+// Aliases are expanded. An error is returned if an alias refers to a
+// node that contains it, or if the expanded document is too large.
+func YAMLToJSON(src []byte) ([]byte, *PositionIndex, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(src, &node); err != nil {
+		return nil, nil, err
+	}
+	if node.Kind == 0 {
+		return nil, nil, errors.New("empty document")
+	}
+
+	c := &yamlConverter{
+		budget:    maxYAMLNodes,
+		expanding: make(map[*yaml.Node]bool),
+		idx:       &PositionIndex{positions: make(map[string]Position)},
+	}
+	if err := c.convert(&node, ""); err != nil {
+		return nil, nil, err
+	}
+	return c.buf.Bytes(), c.idx, nil
+}
+
+type yamlConverter struct {
+	buf       bytes.Buffer
+	budget    int
+	expanding map[*yaml.Node]bool // aliased nodes being converted
+	idx       *PositionIndex
+}
+
+func (c *yamlConverter) convert(node *yaml.Node, ptr string) error {
+	c.budget--
+	if c.budget < 0 {
+		return errors.New("YAML document is too large once aliases are expanded")
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return c.convert(node.Content[0], ptr)
+	case yaml.AliasNode:
+		if c.expanding[node.Alias] {
+			return errors.Errorf("YAML alias *%s at line %d refers to itself", node.Value, node.Line)
+		}
+		c.expanding[node.Alias] = true
+		defer delete(c.expanding, node.Alias)
+		return c.convert(node.Alias, ptr)
+	}
+
+	c.idx.positions[ptr] = Position{Line: node.Line, Column: node.Column}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		c.buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				c.buf.WriteByte(',')
+			}
+			key := node.Content[i].Value
+			buf, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			c.buf.Write(buf)
+			c.buf.WriteByte(':')
+			if err := c.convert(node.Content[i+1], ptr+"/"+escapePointerToken(key)); err != nil {
+				return err
+			}
+		}
+		c.buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		c.buf.WriteByte('[')
+		for i, child := range node.Content {
+			if i > 0 {
+				c.buf.WriteByte(',')
+			}
+			if err := c.convert(child, ptr+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		c.buf.WriteByte(']')
+		return nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		c.buf.WriteString("null")
+		return nil
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return err
+		}
+		c.buf.WriteString(strconv.FormatBool(b))
+		return nil
+	case "!!int", "!!float":
+		var x interface{}
+		if err := node.Decode(&x); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(x)
+		if err != nil {
+			return errors.Wrapf(err, "unsupported number %s at line %d", node.Value, node.Line)
+		}
+		c.buf.Write(buf)
+		return nil
+	}
+
+	buf, err := json.Marshal(node.Value)
+	if err != nil {
+		return err
+	}
+	c.buf.Write(buf)
+	return nil
+}
@@ -1,23 +1,27 @@
 package jsref
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/url"
 	"reflect"
+	"strings"
 
-	"github.com/lestrrat-go/jspointer"
 	"github.com/lestrrat-go/pdebug"
 	"github.com/lestrrat-go/structinfo"
 	"github.com/pkg/errors"
 )
 
 const ref = "$ref"
-var refrv = reflect.ValueOf(ref)
 
 var DefaultMaxRecursions = 10
 
 // New creates a new Resolver
 func New() *Resolver {
-	return &Resolver{MaxRecursions: DefaultMaxRecursions}
+	return &Resolver{
+		keywords:      []*keyword{{name: ref, handler: JSONReference}},
+		MaxRecursions: DefaultMaxRecursions,
+	}
 }
 
 // AddProvider adds a new Provider to be searched for in case
@@ -33,6 +37,49 @@ type resolveCtx struct {
 	object    interface{} // the main object that was passed to `Resolve()`
 	recursive bool	      // should traverseExpandRefRecursive or not
 	seen      []string    // loop detection
+	useNumber bool        // decode numbers in raw JSON as json.Number
+	ordered   bool        // decode objects in raw JSON as *OrderedMap
+	siblings  SiblingPolicy
+	scope     []scopeEntry // documents entered so far, outermost first
+	docURI    string       // URI of the document in `object`
+
+	sourceMap *SourceMap         // where provenance is recorded
+	positions *positionCache     // position indexes of the documents, by URI
+	path      []string           // location within the result being traversed
+	trail     []trailEntry       // values along `path` that replaced a reference
+	located   *Location          // location of the value most recently resolved
+	holder    *resolveCtx        // context of the document holding that value
+	visited   map[uintptr]string // containers traversed so far, and their path
+	inRoot    bool               // true if `object` is the document passed to Resolve
+	resultPtr string             // JSON pointer to the result within that document
+	usage     *usage             // work done so far, checked against the limits
+	lock      *lockState         // lockfile the external documents are checked against
+	refPolicy ReferencePolicy    // decides which references may be followed
+}
+
+// newResolveCtx creates the context for resolving references within
+// `v`, the document at `baseURI`. `ptr` is the location of the result
+// within `v`, and `sourceMap` may be nil.
+func newResolveCtx(r *Resolver, v interface{}, ptr, baseURI string, limits Limits, sourceMap *SourceMap) *resolveCtx {
+	ctx := &resolveCtx{
+		rlevel:    0,
+		maxrlevel: r.MaxRecursions,
+		object:    v,
+		seen:      []string{},
+		docURI:    baseURI,
+		sourceMap: sourceMap,
+		inRoot:    true,
+		resultPtr: strings.TrimPrefix(ptr, "#"),
+		usage:     newUsage(limits),
+		refPolicy: r.ReferencePolicy,
+	}
+	ctx.scope = []scopeEntry{{uri: baseURI, object: v}}
+	ctx.positions = newPositionCache(r, baseURI, v)
+	if ctx.sourceMap != nil {
+		ctx.visited = make(map[uintptr]string)
+		ctx.sourceMap.reset(ctx.positions.index)
+	}
+	return ctx
 }
 
 // Resolve takes a target `v`, and a JSON pointer `spec`.
@@ -50,162 +97,152 @@ type resolveCtx struct {
 // If `WithRecursiveResolution` option is given and its value is true,
 // an attempt to resolve all references within the resulting object
 // is made by traversing the structure recursively. Default is false
+//
+// Keys that appear next to "$ref" are handled according to the
+// Resolver's `SiblingPolicy`, which can be overridden for a single
+// call using the `WithSiblingPolicy` option.
+//
+// If a `SourceMap` is given using the `WithSourceMap` option, the
+// document, JSON pointer and chain of references that each resolved
+// value originates from are recorded in it. Any locations previously
+// recorded in the SourceMap are discarded.
+//
+// If `WithLazyResolution` option is given and its value is true, a
+// `*Node` is returned instead, and the references within the result
+// are resolved as they are accessed through it.
+//
+// If a `Lockfile` is given using the `WithLockfile` option, the
+// external documents loaded through the providers are verified
+// against it, or recorded in it. An `*IntegrityError` is returned
+// when a document does not match the Lockfile.
+//
+// References to external documents are checked against the
+// Resolver's `ReferencePolicy`, which can be overridden for a single
+// call using the `WithReferencePolicy` option. A
+// `*ReferencePolicyError` is returned when a reference is denied.
 func (r *Resolver) Resolve(v interface{}, ptr string, options ...Option) (ret interface{}, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("Resolver.Resolve(%s)", ptr).BindError(&err)
 		defer g.End()
 	}
-	var recursiveResolution bool
-	for _, opt := range options {
-		switch opt.Ident() {
-		case identRecursiveResolution{}:
-			recursiveResolution = opt.Value().(bool)
-		}
-	}
-
-	ctx := resolveCtx{
-		rlevel:    0,
-		maxrlevel: r.MaxRecursions,
-		object:    v,
-		recursive: recursiveResolution,
-		seen:      []string{},
-	}
+	opts := r.resolveOptions(options)
+	ctx := opts.newResolveCtx(r, v, ptr)
 
 	// First, expand the target as much as we can
-	v, err = expandRefRecursive(&ctx, r, v)
+	ctx.located = &Location{Document: opts.baseURI}
+	v, err = expandRefRecursive(ctx, r, v)
 	if err != nil {
 		return nil, errors.Wrap(err, "recursive search failed")
 	}
 
-	result, err := evalptr(&ctx, r, v, ptr)
+	result, err := evalptr(ctx, r, v, ptr)
 	if err != nil {
 		return nil, err
 	}
+	ctx.record()
 
-	if recursiveResolution {
-		rv, err := traverseExpandRefRecursive(&ctx, r, reflect.ValueOf(result))
+	if opts.lazy {
+		holder := ctx.holder
+		if holder == nil {
+			holder = ctx
+		}
+		return newLazyNode(r, holder, ctx.located, result), nil
+	}
+
+	if opts.recursive {
+		result, err = traverseExpandRefRecursive(ctx, r, result)
 		if err != nil {
 			return nil, errors.Wrap(err, `failed to resolve result`)
 		}
-		result = rv.Interface()
 	}
 
 	return result, nil
 }
 
-func setPtrOrInterface(container, value reflect.Value) bool {
-	switch container.Kind() {
-	case reflect.Ptr:
-		if !value.CanAddr() {
-			return false
-		}
-		container.Set(value.Addr())
-	case reflect.Interface:
-		container.Set(value)
-	default:
-		return false
-	}
-	return true
+// resolveOptions holds the options given to `Resolve`, `Set` and
+// `Delete`
+type resolveOptions struct {
+	recursive bool
+	siblings  SiblingPolicy
+	useNumber bool
+	ordered   bool
+	baseURI   string
+	sourceMap *SourceMap
+	limits    Limits
+	lazy      bool
+	lock      lockfileOption
+	refPolicy ReferencePolicy
+	cow       bool
 }
 
-func traverseExpandRefRecursive(ctx *resolveCtx, r *Resolver, rv reflect.Value) (reflect.Value, error) {
-	if pdebug.Enabled {
-		g := pdebug.Marker("traverseExpandRefRecursive")
-		defer g.End()
+func (r *Resolver) resolveOptions(options []Option) *resolveOptions {
+	opts := &resolveOptions{
+		siblings:  r.SiblingPolicy,
+		limits:    r.Limits,
+		refPolicy: r.ReferencePolicy,
 	}
-
-	switch rv.Kind() {
-	case reflect.Ptr, reflect.Interface:
-		rv = rv.Elem()
-	}
-
-	switch rv.Kind() {
-	case reflect.Array, reflect.Slice:
-		for i := 0; i < rv.Len(); i++ {
-			elem := rv.Index(i)
-			var elemcontainer reflect.Value
-			switch elem.Kind() {
-			case reflect.Ptr, reflect.Interface:
-				elemcontainer = elem
-				elem = elem.Elem()
-			}
-
-			// Need to check for elem being Valid, otherwise the
-			// subsequent call to Interface() will fail
-			if !elem.IsValid() {
-				continue
-			}
-
-			if elemcontainer.IsValid() {
-				if !elemcontainer.CanSet() {
-					continue
-				}
-			}
-			newv, err := expandRefRecursive(ctx, r, elem.Interface())
-			if err != nil {
-				return zeroval, errors.Wrap(err, `failed to expand array/slice element`)
-			}
-			newrv, err := traverseExpandRefRecursive(ctx, r, reflect.ValueOf(newv))
-			if err != nil {
-				return zeroval, errors.Wrap(err, `failed to recurse into array/slice element`)
-			}
-
-			if elemcontainer.IsValid() {
-				setPtrOrInterface(elemcontainer, newrv)
-			} else {
-				elem.Set(newrv)
-			}
-		}
-	case reflect.Map:
-		// No refs found in the map keys, but there could be more
-		// in the values
-		if _, err := findRef(rv.Interface()); err != nil {
-			for _, key := range rv.MapKeys() {
-				value, err := traverseExpandRefRecursive(ctx, r, rv.MapIndex(key))
-				if err != nil {
-					return zeroval, errors.Wrap(err, `failed to traverse map value`)
-				}
-				rv.SetMapIndex(key, value)
-			}
-			return rv, nil
-		}
-		newv, err := expandRefRecursive(ctx, r, rv.Interface())
-		if err != nil {
-			return zeroval, errors.Wrap(err, `failed to expand map element`)
-		}
-		return traverseExpandRefRecursive(ctx, r, reflect.ValueOf(newv))
-	case reflect.Struct:
-		// No refs found in the map keys, but there could be more
-		// in the values
-		if _, err := findRef(rv.Interface()); err != nil {
-			for i := 0; i < rv.NumField(); i++ {
-				field := rv.Field(i)
-				value, err := traverseExpandRefRecursive(ctx, r, field)
-				if err != nil {
-					return zeroval, errors.Wrap(err, `failed to traverse struct field value`)
-				}
-				field.Set(value)
-			}
-			return rv, nil
-		}
-		newv, err := expandRefRecursive(ctx, r, rv.Interface())
-		if err != nil {
-			return zeroval, errors.Wrap(err, `failed to expand struct element`)
+	for _, opt := range options {
+		switch opt.Ident() {
+		case identRecursiveResolution{}:
+			opts.recursive = opt.Value().(bool)
+		case identSiblingPolicy{}:
+			opts.siblings = opt.Value().(SiblingPolicy)
+		case identUseNumber{}:
+			opts.useNumber = opt.Value().(bool)
+		case identOrderedObjects{}:
+			opts.ordered = opt.Value().(bool)
+		case identBaseURI{}:
+			opts.baseURI = opt.Value().(string)
+		case identSourceMap{}:
+			opts.sourceMap = opt.Value().(*SourceMap)
+		case identLimits{}:
+			opts.limits = opt.Value().(Limits)
+		case identLazyResolution{}:
+			opts.lazy = opt.Value().(bool)
+		case identLockfile{}:
+			opts.lock = opt.Value().(lockfileOption)
+		case identReferencePolicy{}:
+			opts.refPolicy, _ = opt.Value().(ReferencePolicy)
+		case identCopyOnWrite{}:
+			opts.cow = opt.Value().(bool)
 		}
-		return traverseExpandRefRecursive(ctx, r, reflect.ValueOf(newv))
 	}
-	return rv, nil
+	return opts
+}
+
+// newResolveCtx creates the context for resolving `ptr` within `v`
+// with these options
+func (opts *resolveOptions) newResolveCtx(r *Resolver, v interface{}, ptr string) *resolveCtx {
+	ctx := newResolveCtx(r, v, ptr, opts.baseURI, opts.limits, opts.sourceMap)
+	ctx.lock = newLockState(opts.lock.lockfile, opts.lock.mode)
+	ctx.recursive = opts.recursive
+	ctx.useNumber = opts.useNumber
+	ctx.ordered = opts.ordered
+	ctx.siblings = opts.siblings
+	ctx.refPolicy = opts.refPolicy
+	return ctx
 }
 
 // expands $ref with in v, until all $refs are expanded.
 // note: DOES NOT recurse down into structures
+//
+// If any reference was expanded, ctx.located is updated to point to
+// the location of the final value, or nil if it is unknown.
 func expandRefRecursive(ctx *resolveCtx, r *Resolver, v interface{}) (ret interface{}, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("expandRefRecursive")
 		defer g.End()
 	}
-	for {
-		ref, err := findRef(v)
+
+	var refs []string
+	located := ctx.located
+	holder := ctx.holder
+	for i := 0; ; i++ {
+		if i > ctx.maxrlevel {
+			return nil, ErrMaxRecursion
+		}
+
+		kw, ref, err := findRef(r, v)
 		if err != nil {
 			if pdebug.Enabled {
 				pdebug.Printf("No refs found. bailing out of loop")
@@ -216,40 +253,65 @@ func expandRefRecursive(ctx *resolveCtx, r *Resolver, v interface{}) (ret interf
 		if pdebug.Enabled {
 			pdebug.Printf("Found ref '%s'", ref)
 		}
+		if r.hasHooks() {
+			r.emit(&Event{Kind: EventRefFound, Keyword: kw.name, Ref: ref, Document: ctx.docURI})
+		}
+		if err := ctx.usage.reference(); err != nil {
+			return nil, err
+		}
 
-		newv, err := expandRef(ctx, r, v, ref)
+		rctx := &ReferenceContext{
+			ctx:     ctx,
+			r:       r,
+			keyword: kw.name,
+			node:    v,
+		}
+		ctx.located = nil
+		ctx.holder = nil
+		newv, err := kw.handler.ResolveReference(rctx, ref)
 		if err != nil {
 			if pdebug.Enabled {
 				pdebug.Printf("Failed to expand ref '%s': %s", ref, err)
 			}
-			return nil, errors.Wrap(err, "failed to expand ref")
+			return nil, newRefError(ctx, kw.name, ref, located, err)
+		}
+
+		newv, err = applySiblingPolicy(ctx, kw.name, v, newv)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to apply sibling policy to ref '%s'", ref)
+		}
+
+		refs = append(refs, ref)
+		holder = ctx.holder
+		if ctx.located != nil {
+			loc := *ctx.located
+			loc.Refs = append(append([]string{}, refs...), loc.Refs...)
+			located = &loc
+		} else {
+			located = nil
 		}
 
 		v = newv
 	}
 
+	ctx.located = located
+	ctx.holder = holder
 	return v, nil
 }
 
-func expandRef(ctx *resolveCtx, r *Resolver, v interface{}, ref string) (ret interface{}, err error) {
+// expandRef resolves `ref` following the JSON Reference semantics:
+// the URI part of the reference is used to look up a document from
+// the registered providers, and the fragment is evaluated as a JSON
+// pointer against that document.
+func expandRef(ctx *resolveCtx, r *Resolver, ref string) (ret interface{}, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("expandRef %s", ref)
 		defer g.End()
 	}
-	ctx.rlevel++
-	if ctx.rlevel > ctx.maxrlevel {
-		return nil, ErrMaxRecursion
-	}
-
+	err = ctx.enter(r, ref)
 	defer func() { ctx.rlevel-- }()
-
-	for _, s := range ctx.seen {
-		if s == ref {
-			if pdebug.Enabled {
-				pdebug.Printf("reference loop detected %s", ref)
-			}
-			return nil, ErrReferenceLoop
-		}
+	if err != nil {
+		return nil, err
 	}
 
 	u, err := url.Parse(ref)
@@ -258,7 +320,7 @@ func expandRef(ctx *resolveCtx, r *Resolver, v interface{}, ref string) (ret int
 	}
 
 	ptr := "#" + u.Fragment
-	if u.Host == "" && u.Path == "" {
+	if u.Scheme == "" && u.Opaque == "" && u.Host == "" && u.Path == "" {
 		if pdebug.Enabled {
 			pdebug.Printf("ptr doesn't contain any host/path part, apply json pointer directly to object")
 			// pdebug.Printf("  %v", ctx.object)
@@ -267,25 +329,38 @@ func expandRef(ctx *resolveCtx, r *Resolver, v interface{}, ref string) (ret int
 	}
 
 	u.Fragment = ""
+	if err := ctx.checkReference(u); err != nil {
+		return nil, err
+	}
 	for _, p := range r.providers {
-		pv, err := p.Get(u)
+		pv, err := fetch(ctx, r, p, u, ref)
 		if err == nil {
+			if err := ctx.usage.document(p, u, pv); err != nil {
+				return nil, err
+			}
+			if err := ctx.lock.document(u, pv); err != nil {
+				return nil, err
+			}
 			if pdebug.Enabled {
 				pdebug.Printf("Found object matching %s", u)
 			}
 			newseen := append([]string{}, ctx.seen...)
 			newseen = append(newseen, ref)
-			ctx2 := &resolveCtx{
-				rlevel:    ctx.rlevel,
-				maxrlevel: ctx.maxrlevel,
-				object:    pv,
-				recursive: ctx.recursive,
-				seen:      newseen,
-			}
+			ctx2 := &resolveCtx{}
+			*ctx2 = *ctx
+			ctx2.object = pv
+			ctx2.seen = newseen
+			ctx2.scope = append(append([]scopeEntry{}, ctx.scope...), scopeEntry{uri: u.String(), object: pv})
+			ctx2.docURI = u.String()
+			ctx2.inRoot = false
+			ctx2.path = append([]string{}, ctx.path...)
+			ctx2.trail = append([]trailEntry{}, ctx.trail...)
 			pv, err := evalptr(ctx2, r, pv, ptr)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed on ptr")
 			}
+			ctx.located = ctx2.located
+			ctx.holder = ctx2.holder
 			if !ctx.recursive {
 				return pv, nil
 			}
@@ -294,23 +369,72 @@ func expandRef(ctx *resolveCtx, r *Resolver, v interface{}, ref string) (ret int
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to expand external reference")
 			}
-			rv, err := traverseExpandRefRecursive(ctx2, r, reflect.ValueOf(pv))
+			ctx2.record()
+			pv, err = traverseExpandRefRecursive(ctx2, r, pv)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to traverse external reference")
 			}
-			return rv.Interface(), nil
+			return pv, nil
+		}
+		if errors.Is(err, ErrPolicyViolation) || errors.Is(err, ErrLimitExceeded) {
+			// A provider refused to fetch the document. Trying the next
+			// providers would defeat the purpose of the policy or limit.
+			return nil, errors.Wrapf(err, "failed to fetch $ref '%s'", ref)
 		}
 	}
 
 	return nil, errors.New("element pointed by $ref '" + ref + "' not found")
 }
 
-func findRef(v interface{}) (ref string, err error) {
+// enter accounts for following `ref`, and returns an error if that
+// exceeds the maximum recursion level, or if `ref` is already being
+// followed. The caller must decrement ctx.rlevel when done, even if
+// an error is returned.
+func (ctx *resolveCtx) enter(r *Resolver, ref string) error {
+	ctx.rlevel++
+	if ctx.rlevel > ctx.maxrlevel {
+		return ErrMaxRecursion
+	}
+
+	for _, s := range ctx.seen {
+		if s == ref {
+			if pdebug.Enabled {
+				pdebug.Printf("reference loop detected %s", ref)
+			}
+			if r.hasHooks() {
+				r.emit(&Event{Kind: EventLoopDetected, Ref: ref, Document: ctx.docURI, Err: ErrReferenceLoop})
+			}
+			return ErrReferenceLoop
+		}
+	}
+	return nil
+}
+
+// findRef looks for any of the reference keywords registered in `r`
+// in the object `v`, and returns the first one that is found along
+// with the reference itself.
+func findRef(r *Resolver, v interface{}) (kw *keyword, s string, err error) {
 	if pdebug.Enabled {
 		g := pdebug.Marker("findRef").BindError(&err)
 		defer g.End()
 	}
 
+	for _, kw := range r.keywordList() {
+		s, err = findKeyword(v, kw.name)
+		if err == nil || (s == "#" && allowsRootReference(kw.handler)) {
+			return kw, s, nil
+		}
+	}
+	return nil, "", err
+}
+
+func findKeyword(v interface{}, name string) (string, error) {
+	// Raw JSON documents are scanned for a top-level keyword,
+	// without decoding the rest of the document
+	if raw, ok := v.(json.RawMessage); ok {
+		return findRawKeyword(raw, name)
+	}
+
 	rv := reflect.ValueOf(v)
 	switch rv.Kind() {
 	case reflect.Interface, reflect.Ptr:
@@ -323,19 +447,28 @@ func findRef(v interface{}) (ref string, err error) {
 
 	// Find if we have a "$ref" element
 	var refv reflect.Value
-	switch rv.Kind() {
-	case reflect.Map:
-		refv = rv.MapIndex(refrv)
-	case reflect.Struct:
-		if fn := structinfo.StructFieldFromJSONName(rv, ref); fn != "" {
-			refv = rv.FieldByName(fn)
+	if om, ok := v.(*OrderedMap); ok {
+		if x, ok := om.Get(name); ok {
+			refv = reflect.ValueOf(x)
+		}
+	} else {
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return "", errors.New("element is not a map-like container")
+			}
+			refv = rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		case reflect.Struct:
+			if fn := structinfo.StructFieldFromJSONName(rv, name); fn != "" {
+				refv = rv.FieldByName(fn)
+			}
+		default:
+			return "", errors.New("element is not a map-like container")
 		}
-	default:
-		return "", errors.New("element is not a map-like container")
 	}
 
 	if !refv.IsValid() {
-		return "", errors.New("$ref element not found")
+		return "", errors.New(name + " element not found")
 	}
 
 	switch refv.Kind() {
@@ -347,24 +480,24 @@ func findRef(v interface{}) (ref string, err error) {
 	case reflect.String:
 		// Empty string isn't a valid pointer
 		if refv.Len() <= 0 {
-			return "", errors.New("$ref element not found (empty)")
+			return "", errors.New(name + " element not found (empty)")
 		}
 		if refv.String() == "#" {
-			return "", errors.New("$ref to '#' skipped")
+			return "#", errors.New(name + " to '#' skipped")
 		}
 		if pdebug.Enabled {
 			pdebug.Printf("Found ref '%s'", refv)
 		}
 		return refv.String(), nil
 	case reflect.Invalid:
-		return "", errors.New("$ref element not found")
+		return "", errors.New(name + " element not found")
 	default:
 		if pdebug.Enabled {
-			pdebug.Printf("'$ref' was found, but its kind is %s", refv.Kind())
+			pdebug.Printf("'%s' was found, but its kind is %s", name, refv.Kind())
 		}
 	}
 
-	return "", errors.New("$ref element must be a string")
+	return "", errors.New(name + " element must be a string")
 }
 
 func evalptr(ctx *resolveCtx, r *Resolver, v interface{}, ptrspec string) (ret interface{}, err error) {
@@ -373,11 +506,18 @@ func evalptr(ctx *resolveCtx, r *Resolver, v interface{}, ptrspec string) (ret i
 		defer g.End()
 	}
 
+	raw, isRaw := v.(json.RawMessage)
+
 	// If the reference is empty, return v
 	if ptrspec == "" || ptrspec == "#" {
 		if pdebug.Enabled {
 			pdebug.Printf("Empty pointer, return v itself")
 		}
+		ctx.located = ctx.origin(Location{Document: ctx.docURI})
+		ctx.holder = ctx
+		if isRaw {
+			return decodeRaw(ctx, raw)
+		}
 		return v, nil
 	}
 
@@ -395,18 +535,71 @@ func evalptr(ctx *resolveCtx, r *Resolver, v interface{}, ptrspec string) (ret i
 		return nil, errors.Wrap(err, "empty json pointer")
 	}
 
-	p, err := jspointer.New(ptr)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed create a new JSON pointer")
-	}
-	x, err := p.Get(v)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch value")
+	var x interface{}
+	if ptr[0] != '/' {
+		// Plain name fragments refer to anchors
+		if isRaw {
+			if v, err = decodeRaw(ctx, raw); err != nil {
+				return nil, err
+			}
+		}
+		var ok bool
+		x, ok = findAnchor(v, ptr)
+		if !ok {
+			return nil, pointerFailed(ctx, r, ptr, errors.Errorf("anchor %q not found", ptr))
+		}
+	} else {
+		tokens, err := splitPointer(ptr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed create a new JSON pointer")
+		}
+
+		if isRaw {
+			sub, err := rawLookup(raw, tokens)
+			if err != nil {
+				return nil, pointerFailed(ctx, r, ptr, errors.Wrap(err, "failed to fetch value"))
+			}
+			x, err = decodeRaw(ctx, sub)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			x, err = pointerGet(v, tokens)
+			if err != nil {
+				return nil, pointerFailed(ctx, r, ptr, errors.Wrap(err, "failed to fetch value"))
+			}
+		}
 	}
 
 	if pdebug.Enabled {
 		pdebug.Printf("Evaulated JSON pointer, now checking if we can expand further")
 	}
+	ctx.located = ctx.origin(Location{Document: ctx.docURI, Pointer: ptr})
+	ctx.holder = ctx
 	// If this result contains more refs, expand that
 	return expandRefRecursive(ctx, r, x)
 }
+
+func findRawKeyword(raw json.RawMessage, name string) (string, error) {
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		return "", errors.New("element is not a map-like container")
+	}
+
+	sub, err := rawLookup(raw, []string{name})
+	if err != nil {
+		return "", errors.New(name + " element not found")
+	}
+
+	var s string
+	if err := json.Unmarshal(sub, &s); err != nil {
+		return "", errors.New(name + " element must be a string")
+	}
+
+	switch s {
+	case "":
+		return "", errors.New(name + " element not found (empty)")
+	case "#":
+		return "#", errors.New(name + " to '#' skipped")
+	}
+	return s, nil
+}
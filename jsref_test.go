@@ -2,10 +2,13 @@ package jsref_test
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -465,3 +468,1270 @@ func TestReferenceLoop(t *testing.T) {
 		return
 	}
 }
+
+func TestResolveJSON(t *testing.T) {
+	src := []byte(`{
+  "foo": ["bar", {"$ref": "#/sub"}, {"$ref": "#/deep/a~1b"}],
+  "sub": "baz",
+  "deep": {"skip": [1, {"x": [2, 3]}], "a/b": {"$ref": "#/sub"}},
+  "broken": {"$ref": "#/nonexistent"}
+}`)
+
+	data := map[string]interface{}{
+		"#/foo/0":           "bar",
+		"#/foo/1":           "baz",
+		"#/foo/2":           "baz",
+		"#/deep/skip/1/x/1": float64(3),
+		"#/deep/skip":       []interface{}{float64(1), map[string]interface{}{"x": []interface{}{float64(2), float64(3)}}},
+	}
+
+	res := jsref.New()
+	for ptr, expected := range data {
+		v, err := res.ResolveJSON(src, ptr)
+		if !assert.NoError(t, err, "ResolveJSON(%s) should succeed", ptr) {
+			return
+		}
+		if !assert.Equal(t, expected, v, "ResolveJSON(%s) resolves to '%v'", ptr, expected) {
+			return
+		}
+	}
+
+	v, err := res.ResolveReadAll(strings.NewReader(string(src)), "#/foo", jsref.WithRecursiveResolution(true))
+	if !assert.NoError(t, err, "ResolveReadAll(#/foo) should succeed") {
+		return
+	}
+	if !assert.Equal(t, []interface{}{"bar", "baz", "baz"}, v) {
+		return
+	}
+
+	_, err = res.ResolveJSON(src, "#/broken")
+	if !assert.Error(t, err, "ResolveJSON(#/broken) should fail") {
+		return
+	}
+
+	_, err = res.ResolveJSON([]byte(`{"foo": `), "#/foo")
+	if !assert.Error(t, err, "ResolveJSON with invalid JSON should fail") {
+		return
+	}
+
+	// Like encoding/json, the last of duplicated keys wins
+	v, err = res.ResolveJSON([]byte(`{"a": {"b": 1}, "a": {"b": 2, "c": {"$ref": "#/a/b"}}}`), "#/a/c")
+	if !assert.NoError(t, err, "ResolveJSON(#/a/c) should succeed") {
+		return
+	}
+	if !assert.Equal(t, float64(2), v, "the last duplicated key wins") {
+		return
+	}
+}
+
+func TestResolveFSRawJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsref-test-")
+	if !assert.NoError(t, err, "creating temporary directory should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "obj2")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(`{"big":[1,2,3],"sub":{"$ref":"#/big/2"}}`), 0644), "writing %s should succeed", path) {
+		return
+	}
+
+	m := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"$ref": "file:///obj2#/sub",
+		},
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(provider.NewFS(dir, provider.WithRawJSON(true))), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	v, err := res.Resolve(m, "#/foo")
+	if !assert.NoError(t, err, "Resolve(#/foo) should succeed") {
+		return
+	}
+	if !assert.Equal(t, float64(3), v) {
+		return
+	}
+}
+
+func TestResolveOrderedNumbers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsref-test-")
+	if !assert.NoError(t, err, "creating temporary directory should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "obj2")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(`{"zzz":{"id":9007199254740993,"b":{"$ref":"#/aaa"},"a":true},"aaa":"x"}`), 0644), "writing %s should succeed", path) {
+		return
+	}
+
+	res := jsref.New()
+	fs := provider.NewFS(dir, provider.WithUseNumber(true), provider.WithOrderedObjects(true))
+	if !assert.NoError(t, res.AddProvider(fs), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	src := []byte(`{"root":{"y":1,"x":{"$ref":"file:///obj2#/zzz"},"w":12345678901234567890}}`)
+	v, err := res.ResolveJSON(src, "#/root", jsref.WithRecursiveResolution(true), jsref.WithUseNumber(true), jsref.WithOrderedObjects(true))
+	if !assert.NoError(t, err, "ResolveJSON(#/root) should succeed") {
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, `{"y":1,"x":{"id":9007199254740993,"b":"x","a":true},"w":12345678901234567890}`, string(b)) {
+		return
+	}
+
+	id, err := res.Resolve(v, "#/x/id")
+	if !assert.NoError(t, err, "Resolve(#/x/id) should succeed") {
+		return
+	}
+	if !assert.Equal(t, json.Number("9007199254740993"), id) {
+		return
+	}
+}
+
+func TestSiblingPolicy(t *testing.T) {
+	src := []byte(`{
+  "defs": {"A": {"type": "string", "description": "original"}},
+  "target": {"$ref": "#/defs/A", "description": "override"}
+}`)
+
+	var v interface{}
+	if !assert.NoError(t, json.Unmarshal(src, &v), `Unmarshal should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+
+	result, err := res.Resolve(v, "#/target")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"type": "string", "description": "original"}, result, "siblings are ignored by default") {
+		return
+	}
+
+	result, err = res.Resolve(v, "#/target", jsref.WithSiblingPolicy(jsref.MergeSiblings))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"type": "string", "description": "override"}, result, "siblings are merged") {
+		return
+	}
+
+	res.SiblingPolicy = jsref.AllOfSiblings
+	result, err = res.Resolve(v, "#/target")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	expected := map[string]interface{}{
+		"allOf": []interface{}{
+			map[string]interface{}{"type": "string", "description": "original"},
+			map[string]interface{}{"description": "override"},
+		},
+	}
+	if !assert.Equal(t, expected, result, "siblings are wrapped in allOf") {
+		return
+	}
+
+	// The referenced document must not have been modified
+	orig, err := res.Resolve(v, "#/defs/A/description")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, "original", orig) {
+		return
+	}
+
+	// Siblings are found in raw JSON values as well
+	raw := map[string]interface{}{
+		"defs":   v.(map[string]interface{})["defs"],
+		"target": json.RawMessage(`{"$ref": "#/defs/A", "description": "override"}`),
+	}
+	result, err = res.Resolve(raw, "#/target", jsref.WithSiblingPolicy(jsref.MergeSiblings))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"type": "string", "description": "override"}, result, "siblings of raw JSON are merged") {
+		return
+	}
+
+	result, err = res.Resolve(raw, "#/target", jsref.WithSiblingPolicy(jsref.AllOfSiblings), jsref.WithOrderedObjects(true))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	wrapper, ok := result.(*jsref.OrderedMap)
+	if !assert.True(t, ok, "siblings of ordered raw JSON are wrapped in an OrderedMap") {
+		return
+	}
+	allOf, _ := wrapper.Get("allOf")
+	if !assert.Len(t, allOf, 2, "allOf holds the referenced value and the siblings") {
+		return
+	}
+	siblings, ok := allOf.([]interface{})[1].(*jsref.OrderedMap)
+	if !assert.True(t, ok, "siblings are an OrderedMap") {
+		return
+	}
+	if !assert.Equal(t, []string{"description"}, siblings.Keys()) {
+		return
+	}
+
+	_, err = res.ResolveJSON([]byte(`{"a": 1, "b": {"$ref": "#/a", "x": true}}`), "#/b", jsref.WithSiblingPolicy(jsref.MergeSiblings))
+	if !assert.Error(t, err, "merging into a non-object should fail") {
+		return
+	}
+}
+
+func TestReferenceKeywords(t *testing.T) {
+	src := []byte(`{
+  "defs": {"A": "a", "B": {"$include": "#/defs/A"}},
+  "include": {"$include": "#/defs/B"},
+  "id": {"@id": "urn:example:A"},
+  "ref": {"$ref": "#/defs/B"}
+}`)
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddKeyword("$include", jsref.JSONReference), `res.AddKeyword("$include") should succeed`) {
+		return
+	}
+
+	// "@id" references use names that need to be mapped to pointers
+	// before they can be resolved
+	idHandler := jsref.KeywordHandlerFunc(func(ctx *jsref.ReferenceContext, ref string) (interface{}, error) {
+		if !assert.Equal(t, "@id", ctx.Keyword()) {
+			return nil, errors.New("unexpected keyword")
+		}
+		return ctx.Resolve("#/defs/" + strings.TrimPrefix(ref, "urn:example:"))
+	})
+	if !assert.NoError(t, res.AddKeyword("@id", idHandler), `res.AddKeyword("@id") should succeed`) {
+		return
+	}
+
+	for _, ptr := range []string{"#/include", "#/id", "#/ref"} {
+		v, err := res.ResolveJSON(src, ptr)
+		if !assert.NoError(t, err, "ResolveJSON(%s) should succeed", ptr) {
+			return
+		}
+		if !assert.Equal(t, "a", v, "ResolveJSON(%s) resolves to 'a'", ptr) {
+			return
+		}
+	}
+
+	// Unregistered keywords are left alone
+	v, err := jsref.New().ResolveJSON(src, "#/include")
+	if !assert.NoError(t, err, "ResolveJSON should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"$include": "#/defs/B"}, v) {
+		return
+	}
+}
+
+func TestDynamicReferences(t *testing.T) {
+	tree := map[string]interface{}{
+		"$dynamicAnchor":   "node",
+		"$recursiveAnchor": true,
+		"marker":           "tree",
+		"properties": map[string]interface{}{
+			"dynamic":   map[string]interface{}{"$dynamicRef": "#node"},
+			"recursive": map[string]interface{}{"$recursiveRef": "#"},
+			"anchor":    map[string]interface{}{"$ref": "#node"},
+		},
+	}
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("tree", tree), `mp.Set("tree") should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider() should succeed`) {
+		return
+	}
+	if !assert.NoError(t, res.AddKeyword("$dynamicRef", jsref.DynamicRef), `res.AddKeyword("$dynamicRef") should succeed`) {
+		return
+	}
+	if !assert.NoError(t, res.AddKeyword("$recursiveRef", jsref.RecursiveRef), `res.AddKeyword("$recursiveRef") should succeed`) {
+		return
+	}
+
+	strict := map[string]interface{}{
+		"$dynamicAnchor":   "node",
+		"$recursiveAnchor": true,
+		"marker":           "strict",
+		"dynamic":          map[string]interface{}{"$ref": "tree#/properties/dynamic"},
+		"recursive":        map[string]interface{}{"$ref": "tree#/properties/recursive"},
+		"anchor":           map[string]interface{}{"$ref": "tree#/properties/anchor"},
+	}
+	loose := map[string]interface{}{
+		"marker":    "loose",
+		"dynamic":   map[string]interface{}{"$ref": "tree#/properties/dynamic"},
+		"recursive": map[string]interface{}{"$ref": "tree#/properties/recursive"},
+	}
+
+	data := []struct {
+		Root     interface{}
+		Ptr      string
+		Expected string
+	}{
+		// The outermost document declares the dynamic anchor, so it wins
+		{Root: strict, Ptr: "#/dynamic", Expected: "strict"},
+		{Root: strict, Ptr: "#/recursive", Expected: "strict"},
+		// Plain "$ref" to an anchor is not dynamic
+		{Root: strict, Ptr: "#/anchor", Expected: "tree"},
+		// Without an anchor in the outer document, the static target is used
+		{Root: loose, Ptr: "#/dynamic", Expected: "tree"},
+		{Root: loose, Ptr: "#/recursive", Expected: "tree"},
+	}
+
+	for _, set := range data {
+		v, err := res.Resolve(set.Root, set.Ptr)
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", set.Ptr) {
+			return
+		}
+		m, ok := v.(map[string]interface{})
+		if !assert.True(t, ok, "Resolve(%s) should return a map", set.Ptr) {
+			return
+		}
+		if !assert.Equal(t, set.Expected, m["marker"], "Resolve(%s) resolves to %s", set.Ptr, set.Expected) {
+			return
+		}
+	}
+
+	// Expanding a recursive schema never ends, and must be reported
+	recursive := map[string]interface{}{
+		"$recursiveAnchor": true,
+		"items":            map[string]interface{}{"$recursiveRef": "#"},
+	}
+	_, err := res.Resolve(recursive, "#/items", jsref.WithRecursiveResolution(true))
+	if !assert.True(t, errors.Is(err, jsref.ErrReferenceLoop), "recursive $recursiveRef should be reported as a loop, got %v", err) {
+		return
+	}
+
+	// When an anchor is declared twice, the same object is found on
+	// each run
+	dup := map[string]interface{}{
+		"ref": map[string]interface{}{"$ref": "#dup"},
+		"z":   map[string]interface{}{"$anchor": "dup", "marker": "z"},
+		"a":   map[string]interface{}{"$anchor": "dup", "marker": "a"},
+		"m":   map[string]interface{}{"$anchor": "dup", "marker": "m"},
+	}
+	for i := 0; i < 20; i++ {
+		v, err := res.Resolve(dup, "#/ref")
+		if !assert.NoError(t, err, "Resolve(#/ref) should succeed") {
+			return
+		}
+		if !assert.Equal(t, "a", v.(map[string]interface{})["marker"], "Resolve(#/ref) should find the first anchor in key order") {
+			return
+		}
+	}
+}
+
+func TestEscapedPointer(t *testing.T) {
+	var v interface{}
+	src := []byte(`{"paths": {"/users": {"a~b": {"$ref": "#/paths/~1users/x"}, "x": "quux"}}}`)
+	if !assert.NoError(t, json.Unmarshal(src, &v), `Unmarshal should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+	result, err := res.Resolve(v, "#/paths/~1users/a~0b")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, "quux", result) {
+		return
+	}
+
+	if !assert.Equal(t, "~1users~0", jsref.EscapePointerToken("/users~")) {
+		return
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	var v interface{}
+	src := []byte(`{
+  "pet": {"$ref": "pets.json#/Pet"},
+  "alias": {"$ref": "#/pet"},
+  "list": [{"name": "local"}]
+}`)
+	if !assert.NoError(t, json.Unmarshal(src, &v), `Unmarshal should succeed`) {
+		return
+	}
+
+	var pets interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(`{"Pet": {"owner": {"$ref": "#/Owner"}}, "Owner": {"name": "alice"}}`), &pets), `Unmarshal should succeed`) {
+		return
+	}
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("pets.json", pets), `mp.Set("pets") should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider should succeed`) {
+		return
+	}
+
+	sm := jsref.NewSourceMap()
+	_, err := res.Resolve(v, "", jsref.WithRecursiveResolution(true), jsref.WithBaseURI("mem:root"), jsref.WithSourceMap(sm))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+
+	data := map[string]jsref.Location{
+		"":                   {Document: "mem:root", Pointer: ""},
+		"/list/0/name":       {Document: "mem:root", Pointer: "/list/0/name"},
+		"/pet":               {Document: "pets.json", Pointer: "/Pet", Refs: []string{"pets.json#/Pet"}},
+		"/pet/owner":         {Document: "pets.json", Pointer: "/Owner", Refs: []string{"#/Owner"}},
+		"/pet/owner/name":    {Document: "pets.json", Pointer: "/Owner/name", Refs: []string{"#/Owner"}},
+		"/alias":             {Document: "pets.json", Pointer: "/Pet", Refs: []string{"#/pet", "pets.json#/Pet"}},
+		"#/alias/owner/name": {Document: "pets.json", Pointer: "/Owner/name", Refs: []string{"#/Owner"}},
+	}
+	for ptr, expected := range data {
+		loc, ok := sm.Lookup(ptr)
+		if !assert.True(t, ok, "Lookup(%s) should succeed", ptr) {
+			return
+		}
+		if !assert.Equal(t, expected, loc, "Lookup(%s) should match", ptr) {
+			return
+		}
+	}
+
+	if !assert.Equal(t, "pets.json#/Owner/name", data["/pet/owner/name"].String()) {
+		return
+	}
+}
+
+func TestPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsref-test-")
+	if !assert.NoError(t, err, "creating temporary directory should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "user.json")
+	src := "{\n  \"name\": {\"type\": \"string\"},\n  \"pet\": {\n    \"$ref\": \"#/Pet\"\n  }\n}"
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(src), 0644), "writing %s should succeed", path) {
+		return
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(provider.NewFS(dir, provider.WithPositions(true))), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	sm := jsref.NewSourceMap()
+	_, err = res.ResolveJSON([]byte(`{"user": {"$ref": "file:///user.json#/name"}}`), "#/user", jsref.WithBaseURI("root.json"), jsref.WithSourceMap(sm))
+	if !assert.NoError(t, err, "ResolveJSON should succeed") {
+		return
+	}
+	loc, ok := sm.Lookup("")
+	if !assert.True(t, ok, "Lookup should succeed") {
+		return
+	}
+	if !assert.Equal(t, jsref.Position{Line: 2, Column: 11, Offset: 12}, loc.Position) {
+		return
+	}
+
+	// The broken reference is inside user.json
+	_, err = res.ResolveJSON([]byte(`{"user": {"$ref": "file:///user.json"}}`), "#/user", jsref.WithRecursiveResolution(true))
+	var rerr *jsref.RefError
+	if !assert.True(t, errors.As(err, &rerr), "error should be a RefError") {
+		return
+	}
+	if !assert.Equal(t, "#/Pet", rerr.Ref) {
+		return
+	}
+	if !assert.Equal(t, "file:///user.json", rerr.Location.Document) {
+		return
+	}
+	if !assert.Equal(t, "/pet", rerr.Location.Pointer) {
+		return
+	}
+	if !assert.Equal(t, jsref.Position{Line: 4, Column: 13, Offset: 55}, rerr.Location.Position) {
+		return
+	}
+
+	// The broken reference is in the document itself
+	_, err = res.ResolveJSON([]byte("{\n  \"a\": {\"$ref\": \"#/b\"}\n}"), "#/a", jsref.WithBaseURI("root.json"))
+	if !assert.True(t, errors.As(err, &rerr), "error should be a RefError") {
+		return
+	}
+	if !assert.Contains(t, err.Error(), "root.json:2:17") {
+		return
+	}
+}
+
+func TestHooks(t *testing.T) {
+	obj1 := map[string]interface{}{
+		"ok":     map[string]interface{}{"$ref": "obj2#/bar"},
+		"broken": map[string]interface{}{"$ref": "obj2#/nothing"},
+		"loop":   map[string]interface{}{"$ref": "obj2#/loop"},
+		"sub":    "baz",
+	}
+	obj2 := map[string]interface{}{
+		"bar":  "quux",
+		"loop": map[string]interface{}{"$ref": "obj2#/loop"},
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(provider.NewMap()), `res.AddProvider() should succeed`) {
+		return
+	}
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("obj2", obj2), `mp.Set("obj2") should succeed`) {
+		return
+	}
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	var events []*jsref.Event
+	if !assert.NoError(t, res.AddHook(jsref.HookFunc(func(ev *jsref.Event) { events = append(events, ev) })), `res.AddHook() should succeed`) {
+		return
+	}
+
+	kinds := func() []jsref.EventKind {
+		var l []jsref.EventKind
+		for _, ev := range events {
+			l = append(l, ev.Kind)
+		}
+		events = nil
+		return l
+	}
+
+	fetched := []jsref.EventKind{
+		jsref.EventRefFound,
+		jsref.EventFetchStart, jsref.EventFetchEnd, jsref.EventProviderMiss,
+		jsref.EventFetchStart, jsref.EventFetchEnd, jsref.EventProviderHit,
+	}
+
+	_, err := res.Resolve(obj1, "#/ok")
+	if !assert.NoError(t, err, "Resolve(#/ok) should succeed") {
+		return
+	}
+	if !assert.Equal(t, fetched, kinds()) {
+		return
+	}
+
+	_, err = res.Resolve(obj1, "#/broken")
+	if !assert.Error(t, err, "Resolve(#/broken) should fail") {
+		return
+	}
+	if !assert.Equal(t, append(fetched, jsref.EventPointerFailed), kinds()) {
+		return
+	}
+
+	_, err = res.Resolve(obj1, "#/loop")
+	if !assert.True(t, errors.Is(err, jsref.ErrReferenceLoop), "Resolve(#/loop) should detect the loop") {
+		return
+	}
+	l := kinds()
+	if !assert.Equal(t, jsref.EventLoopDetected, l[len(l)-1]) {
+		return
+	}
+}
+
+func TestLimits(t *testing.T) {
+	src := `{
+  "a": ["lol", "lol", "lol", "lol"],
+  "b": [{"$ref": "#/a"}, {"$ref": "#/a"}, {"$ref": "#/a"}, {"$ref": "#/a"}],
+  "c": [{"$ref": "#/b"}, {"$ref": "#/b"}, {"$ref": "#/b"}, {"$ref": "#/b"}],
+  "d": [{"$ref": "#/c"}, {"$ref": "#/c"}, {"$ref": "#/c"}, {"$ref": "#/c"}]
+}`
+	laughs := func() interface{} {
+		var v interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(src), &v), `Unmarshal should succeed`) {
+			t.FailNow()
+		}
+		return v
+	}
+
+	// The documents are raw JSON, so that their size is known
+	mp := provider.NewMap()
+	for _, name := range []string{"obj1", "obj2", "obj3"} {
+		if !assert.NoError(t, mp.Set(name, json.RawMessage(`{"name":"`+name+`"}`)), `mp.Set(%s) should succeed`, name) {
+			return
+		}
+	}
+	// Recursive resolution replaces references in place, so each
+	// test case needs a fresh copy
+	docs := func() interface{} {
+		return map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"$ref": "obj1#/name"},
+				map[string]interface{}{"$ref": "obj2#/name"},
+				map[string]interface{}{"$ref": "obj1#/name"},
+				map[string]interface{}{"$ref": "obj3#/name"},
+			},
+		}
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	data := []struct {
+		Name   string
+		Doc    interface{}
+		Limits jsref.Limits
+		Limit  string
+	}{
+		{Name: "references", Doc: laughs(), Limits: jsref.Limits{MaxReferences: 10}, Limit: "references"},
+		{Name: "nodes", Doc: laughs(), Limits: jsref.Limits{MaxNodes: 50}, Limit: "nodes"},
+		{Name: "documents", Doc: docs(), Limits: jsref.Limits{MaxDocuments: 2}, Limit: "documents"},
+		{Name: "bytes", Doc: docs(), Limits: jsref.Limits{MaxBytes: 32}, Limit: "bytes"},
+		{Name: "within limits", Doc: docs(), Limits: jsref.Limits{MaxDocuments: 3, MaxReferences: 4, MaxNodes: 5}},
+	}
+
+	for _, set := range data {
+		_, err := res.Resolve(set.Doc, "", jsref.WithRecursiveResolution(true), jsref.WithLimits(set.Limits))
+		if set.Limit == "" {
+			if !assert.NoError(t, err, "%s: Resolve should succeed", set.Name) {
+				return
+			}
+			continue
+		}
+
+		var lerr *jsref.LimitError
+		if !assert.True(t, errors.As(err, &lerr), "%s: error should be a LimitError, got %v", set.Name, err) {
+			return
+		}
+		if !assert.Equal(t, set.Limit, lerr.Limit, "%s: limit should match", set.Name) {
+			return
+		}
+		if !assert.True(t, errors.Is(err, jsref.ErrLimitExceeded), "%s: error should match ErrLimitExceeded", set.Name) {
+			return
+		}
+	}
+
+	// Providers stop reading documents that are too large
+	dir, err := ioutil.TempDir("", "jsref-test-")
+	if !assert.NoError(t, err, "creating temporary directory should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	big := `{"name": "big", "padding": "` + strings.Repeat("x", 1024) + `"}`
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "big.json"), []byte(big), 0644), "writing big.json should succeed") {
+		return
+	}
+	for _, raw := range []bool{false, true} {
+		fsres := jsref.New()
+		if !assert.NoError(t, fsres.AddProvider(provider.NewFS(dir, provider.WithMaxBytes(64), provider.WithRawJSON(raw))), `res.AddProvider() should succeed`) {
+			return
+		}
+		_, err = fsres.Resolve(map[string]interface{}{"$ref": "file:///big.json#/name"}, "")
+		var lerr *jsref.LimitError
+		if !assert.True(t, errors.As(err, &lerr), "raw=%t: error should be a LimitError, got %v", raw, err) {
+			return
+		}
+		if !assert.Equal(t, "bytes", lerr.Limit) {
+			return
+		}
+	}
+
+	// Without limits, the document expands to 64 copies of "a"
+	v, err := res.Resolve(laughs(), "#/d", jsref.WithRecursiveResolution(true))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	v, err = jsref.EvalPointer(v, "#/3/3/3")
+	if !assert.NoError(t, err, "EvalPointer should succeed") {
+		return
+	}
+	if !assert.Equal(t, []interface{}{"lol", "lol", "lol", "lol"}, v) {
+		return
+	}
+}
+
+func TestLazyResolution(t *testing.T) {
+	var root, tree interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "node": {"$ref": "tree#/Node"},
+  "unused": {"$ref": "unused#/Nothing"},
+  "name": {"$ref": "#/names/0"},
+  "names": ["alice", "bob"]
+}`), &root), `Unmarshal should succeed`) {
+		return
+	}
+	if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "Node": {"value": {"$ref": "#/Value"}, "next": {"$ref": "#/Node"}},
+  "Value": {"type": "integer"}
+}`), &tree), `Unmarshal should succeed`) {
+		return
+	}
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("tree", tree), `mp.Set("tree") should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider() should succeed`) {
+		return
+	}
+	var fetched []string
+	_ = res.AddHook(jsref.HookFunc(func(ev *jsref.Event) {
+		if ev.Kind == jsref.EventFetchStart {
+			fetched = append(fetched, ev.URL.String())
+		}
+	}))
+
+	v, err := res.Resolve(root, "", jsref.WithLazyResolution(true))
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	n, ok := v.(*jsref.Node)
+	if !assert.True(t, ok, "Resolve should return a *Node") {
+		return
+	}
+	if !assert.Empty(t, fetched, "nothing should be fetched until accessed") {
+		return
+	}
+	if !assert.Equal(t, []string{"name", "names", "node", "unused"}, n.Keys()) {
+		return
+	}
+
+	name, err := n.Get("name")
+	if !assert.NoError(t, err, "Get(name) should succeed") {
+		return
+	}
+	if !assert.Equal(t, "alice", name.Value()) {
+		return
+	}
+
+	node, err := n.Get("node")
+	if !assert.NoError(t, err, "Get(node) should succeed") {
+		return
+	}
+	if !assert.Equal(t, "tree#/Node", node.Location().String()) {
+		return
+	}
+
+	// Cycles resolve to the same node
+	next, err := node.Get("next")
+	if !assert.NoError(t, err, "Get(next) should succeed") {
+		return
+	}
+	if !assert.True(t, next == node, "next should be the same node") {
+		return
+	}
+
+	x, err := jsref.EvalPointer(n, "#/node/next/next/value/type")
+	if !assert.NoError(t, err, "EvalPointer should succeed") {
+		return
+	}
+	if !assert.Equal(t, "integer", x.(*jsref.Node).Value()) {
+		return
+	}
+	if !assert.Equal(t, []string{"tree"}, fetched, "only the accessed document should be fetched") {
+		return
+	}
+
+	value, err := node.Get("value")
+	if !assert.NoError(t, err, "Get(value) should succeed") {
+		return
+	}
+	buf, err := json.Marshal(value)
+	if !assert.NoError(t, err, "Marshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, `{"type":"integer"}`, string(buf)) {
+		return
+	}
+
+	_, err = node.Expand()
+	if !assert.True(t, errors.Is(err, jsref.ErrReferenceLoop), "Expand should detect the cycle") {
+		return
+	}
+}
+
+func TestWrite(t *testing.T) {
+	newDocs := func() (interface{}, interface{}) {
+		var root, schemas interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "paths": {"/users": {"get": {"schema": {"$ref": "schemas#/User"}}}},
+  "tags": ["a", "b", "c"]
+}`), &root), `Unmarshal should succeed`) {
+			t.FailNow()
+		}
+		if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "User": {"properties": {"id": {"$ref": "#/Id"}}},
+  "Id": {"type": "integer"}
+}`), &schemas), `Unmarshal should succeed`) {
+			t.FailNow()
+		}
+		return root, schemas
+	}
+
+	root, schemas := newDocs()
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("schemas", schemas), `mp.Set("schemas") should succeed`) {
+		return
+	}
+	res := jsref.New()
+	if !assert.NoError(t, res.AddProvider(mp), `res.AddProvider() should succeed`) {
+		return
+	}
+
+	// The value is set in the document that holds it
+	wr, err := res.Set(root, "#/paths/~1users/get/schema/properties/id/format", "int64", jsref.WithBaseURI("root.json"))
+	if !assert.NoError(t, err, "Set should succeed") {
+		return
+	}
+	if !assert.Equal(t, "schemas", wr.Document) {
+		return
+	}
+	if !assert.Equal(t, "/Id/format", wr.Pointer) {
+		return
+	}
+	if !assert.Equal(t, []string{"schemas#/User", "#/Id"}, wr.Refs) {
+		return
+	}
+	v, err := jsref.EvalPointer(schemas, "#/Id/format")
+	if !assert.NoError(t, err, "EvalPointer should succeed") {
+		return
+	}
+	if !assert.Equal(t, "int64", v) {
+		return
+	}
+
+	// Options are applied as with Resolve
+	denyAll := jsref.ReferencePolicyFunc(func(origin, target *url.URL) error {
+		return errors.New("no external references")
+	})
+	_, err = res.Set(root, "#/paths/~1users/get/schema/properties/id/minimum", 1, jsref.WithBaseURI("root.json"), jsref.WithReferencePolicy(denyAll))
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Set should fail when the policy denies the reference, got %v", err) {
+		return
+	}
+	if _, err := jsref.EvalPointer(schemas, "#/Id/minimum"); !assert.Error(t, err, "minimum should not be set") {
+		return
+	}
+
+	// Local values, appending and deleting
+	wr, err = res.Set(root, "#/tags/-", "d", jsref.WithBaseURI("root.json"))
+	if !assert.NoError(t, err, "Set should succeed") {
+		return
+	}
+	if !assert.Equal(t, "root.json", wr.Document) {
+		return
+	}
+	wr, err = res.Delete(wr.Value, "#/tags/0")
+	if !assert.NoError(t, err, "Delete should succeed") {
+		return
+	}
+	v, err = jsref.EvalPointer(wr.Value, "#/tags")
+	if !assert.NoError(t, err, "EvalPointer should succeed") {
+		return
+	}
+	if !assert.Equal(t, []interface{}{"b", "c", "d"}, v) {
+		return
+	}
+
+	// Copy on write leaves the documents untouched
+	wr, err = res.Delete(root, "#/paths/~1users/get/schema/properties/id/format", jsref.WithCopyOnWrite(true))
+	if !assert.NoError(t, err, "Delete should succeed") {
+		return
+	}
+	if _, err := jsref.EvalPointer(wr.Value, "#/Id/format"); !assert.Error(t, err, "format should be deleted from the copy") {
+		return
+	}
+	if _, err := jsref.EvalPointer(schemas, "#/Id/format"); !assert.NoError(t, err, "format should be kept in the original") {
+		return
+	}
+
+	if _, err := res.Delete(root, "#/nothing/here"); !assert.Error(t, err, "Delete of a missing value should fail") {
+		return
+	}
+
+	// Nil maps are allocated, and stored in their parent
+	nilmap := map[string]interface{}{"a": map[string]interface{}(nil)}
+	if _, err := res.Set(nilmap, "#/a/x", 1); !assert.NoError(t, err, "Set in a nil map should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"x": 1}, nilmap["a"]) {
+		return
+	}
+
+	type T struct {
+		Tags map[string]int `json:"tags"`
+	}
+	st := &T{}
+	if _, err := res.Set(st, "#/tags/x", 1); !assert.NoError(t, err, "Set in a nil map field should succeed") {
+		return
+	}
+	if !assert.Equal(t, map[string]int{"x": 1}, st.Tags) {
+		return
+	}
+}
+
+func TestRewriteRefs(t *testing.T) {
+	newDoc := func() interface{} {
+		var v interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "a": {"$ref": "old.json#/definitions/A"},
+  "b": [{"$ref": "#/definitions/B"}, {"$ref": "http://example.com/schemas/c.json#/C"}],
+  "properties": {"$ref": {"type": "string"}}
+}`), &v), `Unmarshal should succeed`) {
+			t.FailNow()
+		}
+		return v
+	}
+
+	res := jsref.New()
+
+	doc := newDoc()
+	out, err := res.RewriteRefs(doc, jsref.PrefixRewrite(map[string]string{
+		"old.json#/definitions/": "new.json#/$defs/",
+		"old.json#":              "other.json#",
+	}), jsref.WithCopyOnWrite(true))
+	if !assert.NoError(t, err, "RewriteRefs should succeed") {
+		return
+	}
+	v, _ := jsref.EvalPointer(out, "#/a/$ref")
+	if !assert.Equal(t, "new.json#/$defs/A", v) {
+		return
+	}
+	v, _ = jsref.EvalPointer(doc, "#/a/$ref")
+	if !assert.Equal(t, "old.json#/definitions/A", v, "original should be untouched") {
+		return
+	}
+
+	base := "http://example.com/schemas/root.json"
+	data := map[string][]string{
+		"absolutize": {
+			"http://example.com/schemas/old.json#/definitions/A",
+			"http://example.com/schemas/root.json#/definitions/B",
+			"http://example.com/schemas/c.json#/C",
+		},
+		"relativize": {
+			"old.json#/definitions/A",
+			"#/definitions/B",
+			"c.json#/C",
+		},
+	}
+	for name, expected := range data {
+		fn := jsref.AbsolutizeRefs(base)
+		if name == "relativize" {
+			fn = jsref.ChainRewrites(fn, jsref.RelativizeRefs(base))
+		}
+
+		doc := newDoc()
+		_, err := res.RewriteRefs(doc, fn)
+		if !assert.NoError(t, err, "%s: RewriteRefs should succeed", name) {
+			return
+		}
+		for i, ptr := range []string{"#/a/$ref", "#/b/0/$ref", "#/b/1/$ref"} {
+			v, err := jsref.EvalPointer(doc, ptr)
+			if !assert.NoError(t, err, "%s: EvalPointer(%s) should succeed", name, ptr) {
+				return
+			}
+			if !assert.Equal(t, expected[i], v, "%s: %s should match", name, ptr) {
+				return
+			}
+		}
+
+		// Properties named "$ref" are not references
+		v, _ := jsref.EvalPointer(doc, "#/properties/$ref/type")
+		if !assert.Equal(t, "string", v) {
+			return
+		}
+	}
+
+	if !assert.Equal(t, "../shared/x.json#/X", mustRelativize(t, "/a/b/root.json", "/a/shared/x.json#/X")) {
+		return
+	}
+}
+
+func mustRelativize(t *testing.T, base, ref string) string {
+	s, err := jsref.RelativizeRefs(base)("$ref", ref)
+	if !assert.NoError(t, err, "RelativizeRefs should succeed") {
+		t.FailNow()
+	}
+	return s
+}
+
+func TestResolveAs(t *testing.T) {
+	type pet struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	var doc interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(`{
+  "pets": [{"$ref": "#/definitions/dog"}],
+  "definitions": {
+    "dog": {"name": "dog", "tags": ["good"]}
+  },
+  "count": 3,
+  "nothing": null
+}`), &doc), `Unmarshal should succeed`) {
+		return
+	}
+
+	res := jsref.New()
+
+	p, err := jsref.ResolveAs[pet](res, doc, "#/pets/0")
+	if !assert.NoError(t, err, "ResolveAs should succeed") {
+		return
+	}
+	if !assert.Equal(t, pet{Name: "dog", Tags: []string{"good"}}, p) {
+		return
+	}
+
+	pets, err := jsref.ResolveAs[[]pet](res, doc, "#/pets", jsref.WithRecursiveResolution(true))
+	if !assert.NoError(t, err, "ResolveAs should succeed") {
+		return
+	}
+	if !assert.Equal(t, []pet{{Name: "dog", Tags: []string{"good"}}}, pets) {
+		return
+	}
+
+	// Values of the requested type are returned as they are
+	m, err := jsref.ResolveAs[map[string]interface{}](res, doc, "#/definitions/dog")
+	if !assert.NoError(t, err, "ResolveAs should succeed") {
+		return
+	}
+	if !assert.Equal(t, "dog", m["name"]) {
+		return
+	}
+
+	n, err := jsref.ResolveAs[int](res, doc, "#/count")
+	if !assert.NoError(t, err, "ResolveAs should succeed") {
+		return
+	}
+	if !assert.Equal(t, 3, n) {
+		return
+	}
+
+	ptr, err := jsref.ResolveAs[*pet](res, doc, "#/nothing")
+	if !assert.NoError(t, err, "ResolveAs should succeed") {
+		return
+	}
+	if !assert.Nil(t, ptr) {
+		return
+	}
+
+	for _, ptr := range []string{"#/count", "#/nothing"} {
+		_, err = jsref.ResolveAs[string](res, doc, ptr)
+		if !assert.Error(t, err, "ResolveAs(%s) should fail", ptr) {
+			return
+		}
+		var terr *jsref.TypeError
+		if !assert.True(t, errors.As(err, &terr), "error should be a TypeError, got %v", err) {
+			return
+		}
+		if !assert.True(t, errors.Is(err, jsref.ErrTypeMismatch), "error should match ErrTypeMismatch") {
+			return
+		}
+		if !assert.Equal(t, ptr, terr.Source) {
+			return
+		}
+	}
+
+	mp := provider.NewMap()
+	mp.Set("http://example.com/raw.json", json.RawMessage(`{"name": "cat", "tags": []}`))
+	u, _ := url.Parse("http://example.com/raw.json")
+	cat, err := jsref.GetAs[pet](mp, u)
+	if !assert.NoError(t, err, "GetAs should succeed") {
+		return
+	}
+	if !assert.Equal(t, "cat", cat.Name) {
+		return
+	}
+}
+
+func TestReferencePolicy(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		switch r.URL.Path {
+		case "/a.json":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"local": map[string]interface{}{"$ref": "file:///secret.json#/password"},
+				"same":  map[string]interface{}{"$ref": srv.URL + "/b.json#/v"},
+				"other": map[string]interface{}{"$ref": "http://localhost:" + port + "/b.json#/v"},
+				"rel":   map[string]interface{}{"$ref": "b.json#/v"},
+				"net":   map[string]interface{}{"$ref": "//localhost:" + port + "/b.json#/v"},
+			})
+		default:
+			w.Write([]byte(`{"v": "b"}`))
+		}
+	}))
+	defer srv.Close()
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("file:///secret.json", map[string]interface{}{"password": "hunter2"}), "mp.Set should succeed") {
+		return
+	}
+	if !assert.NoError(t, mp.Set("b.json", map[string]interface{}{"v": "relative"}), "mp.Set should succeed") {
+		return
+	}
+	res := jsref.New()
+	res.AddProvider(provider.NewHTTP())
+	res.AddProvider(mp)
+
+	remote := func(ptr string) map[string]interface{} {
+		return map[string]interface{}{"$ref": srv.URL + "/a.json#" + ptr}
+	}
+
+	v, err := res.Resolve(remote("/local"), "")
+	if !assert.NoError(t, err, "Resolve should succeed without a policy") {
+		return
+	}
+	if !assert.Equal(t, "hunter2", v, "remote document can read local file without a policy") {
+		return
+	}
+
+	res.ReferencePolicy = jsref.SameOriginPolicy
+	v, err = res.Resolve(remote("/same"), "")
+	if !assert.NoError(t, err, "Resolve should follow same origin reference") {
+		return
+	}
+	if !assert.Equal(t, "b", v, "Resolve should return the referenced value") {
+		return
+	}
+
+	// Relative references are checked against the document that
+	// holds them
+	var checked []string
+	res.ReferencePolicy = jsref.ReferencePolicyFunc(func(origin, target *url.URL) error {
+		checked = append(checked, target.String())
+		return jsref.SameOriginPolicy.CheckReference(origin, target)
+	})
+	v, err = res.Resolve(remote("/rel"), "")
+	if !assert.NoError(t, err, "Resolve should follow relative same origin reference") {
+		return
+	}
+	if !assert.Equal(t, "relative", v, "Resolve should return the referenced value") {
+		return
+	}
+	if !assert.Equal(t, []string{srv.URL + "/a.json", srv.URL + "/b.json"}, checked, "policy should be given the resolved reference") {
+		return
+	}
+
+	for _, ptr := range []string{"/local", "/other", "/net"} {
+		_, err = res.Resolve(remote(ptr), "")
+		if !assert.Error(t, err, "Resolve(%s) should fail", ptr) {
+			return
+		}
+		if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Resolve(%s): error should match ErrPolicyViolation, got %v", ptr, err) {
+			return
+		}
+		var perr *jsref.ReferencePolicyError
+		if !assert.True(t, errors.As(err, &perr), "Resolve(%s): error should be a ReferencePolicyError", ptr) {
+			return
+		}
+		if !assert.Equal(t, srv.URL+"/a.json", perr.Origin, "Resolve(%s): origin should be the referring document", ptr) {
+			return
+		}
+	}
+
+	// The document given to Resolve is trusted, unless its URI says
+	// otherwise
+	local := map[string]interface{}{"$ref": "file:///secret.json#/password"}
+	if _, err := res.Resolve(local, ""); !assert.NoError(t, err, "Resolve should allow references from the root document") {
+		return
+	}
+	_, err = res.Resolve(local, "", jsref.WithBaseURI("https://example.com/spec.json"))
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Resolve should deny references from a remote base URI, got %v", err) {
+		return
+	}
+
+	denyAll := jsref.ReferencePolicyFunc(func(origin, target *url.URL) error {
+		return errors.New("no external references")
+	})
+	_, err = res.Resolve(local, "", jsref.WithReferencePolicy(denyAll))
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "WithReferencePolicy should override the policy, got %v", err) {
+		return
+	}
+	if _, err := res.Resolve(remote("/local"), "", jsref.WithReferencePolicy(nil)); !assert.NoError(t, err, "WithReferencePolicy(nil) should allow any reference") {
+		return
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	mp := provider.NewMap()
+	mp.Set("http://example.com/a.json", map[string]interface{}{
+		"a": map[string]interface{}{"$ref": "http://example.com/b.json#/b"},
+	})
+	mp.Set("http://example.com/b.json", json.RawMessage(`{"b": {"n": 1.50, "s": "x"}}`))
+
+	res := jsref.New()
+	res.AddProvider(mp)
+	doc := func() map[string]interface{} {
+		return map[string]interface{}{
+			"x": map[string]interface{}{"$ref": "http://example.com/a.json#/a"},
+		}
+	}
+
+	lock := jsref.NewLockfile()
+	_, err := res.Resolve(doc(), "#/x", jsref.WithRecursiveResolution(true), jsref.WithLockfile(lock, jsref.LockUpdate))
+	if !assert.NoError(t, err, "Resolve updating the lockfile should succeed") {
+		return
+	}
+	if !assert.Equal(t, []string{"http://example.com/a.json", "http://example.com/b.json"}, lock.URLs()) {
+		return
+	}
+	if _, ok := lock.Digest("HTTP://Example.COM:80/x/../a.json#/a"); !assert.True(t, ok, "URLs should be normalized") {
+		return
+	}
+
+	var buf strings.Builder
+	if _, err := lock.WriteTo(&buf); !assert.NoError(t, err, "WriteTo should succeed") {
+		return
+	}
+	lock, err = jsref.ReadLockfile(strings.NewReader(buf.String()))
+	if !assert.NoError(t, err, "ReadLockfile should succeed") {
+		return
+	}
+
+	_, err = res.Resolve(doc(), "#/x", jsref.WithRecursiveResolution(true), jsref.WithLockfile(lock, jsref.LockVerify))
+	if !assert.NoError(t, err, "Resolve verifying the lockfile should succeed") {
+		return
+	}
+
+	// Reformatting a document does not change its digest
+	mp.Set("http://example.com/b.json", json.RawMessage(`{ "b": { "s": "x", "n": 1.5 } }`))
+	_, err = res.Resolve(doc(), "#/x", jsref.WithRecursiveResolution(true), jsref.WithLockfile(lock, jsref.LockVerify))
+	if !assert.NoError(t, err, "Resolve of a reformatted document should succeed") {
+		return
+	}
+
+	mp.Set("http://example.com/b.json", json.RawMessage(`{"b": {"n": 2, "s": "x"}}`))
+	_, err = res.Resolve(doc(), "#/x", jsref.WithRecursiveResolution(true), jsref.WithLockfile(lock, jsref.LockVerify))
+	if !assert.Error(t, err, "Resolve of a modified document should fail") {
+		return
+	}
+	var ierr *jsref.IntegrityError
+	if !assert.True(t, errors.As(err, &ierr), "error should be an IntegrityError, got %v", err) {
+		return
+	}
+	if !assert.True(t, errors.Is(err, jsref.ErrIntegrity), "error should match ErrIntegrity") {
+		return
+	}
+	if !assert.Equal(t, "http://example.com/b.json", ierr.URL) {
+		return
+	}
+	expected, _ := lock.Digest("http://example.com/b.json")
+	if !assert.Equal(t, expected, ierr.Expected) {
+		return
+	}
+
+	_, err = res.Resolve(doc(), "#/x", jsref.WithLockfile(jsref.NewLockfile(), jsref.LockVerify))
+	if !assert.True(t, errors.Is(err, jsref.ErrIntegrity), "documents missing from the lockfile should fail, got %v", err) {
+		return
+	}
+}
+
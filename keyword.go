@@ -0,0 +1,104 @@
+package jsref
+
+import (
+	"github.com/pkg/errors"
+)
+
+// KeywordHandler resolves references that are found under a reference
+// keyword, such as "$ref". The handler receives the reference (the
+// string value associated with the keyword), and returns the value
+// it points to.
+type KeywordHandler interface {
+	ResolveReference(*ReferenceContext, string) (interface{}, error)
+}
+
+// KeywordHandlerFunc is a KeywordHandler represented as a function
+type KeywordHandlerFunc func(*ReferenceContext, string) (interface{}, error)
+
+func (f KeywordHandlerFunc) ResolveReference(ctx *ReferenceContext, ref string) (interface{}, error) {
+	return f(ctx, ref)
+}
+
+// JSONReference is the KeywordHandler that implements the semantics of
+// JSON Reference: the URI part of the reference is used to fetch the
+// document from one of the registered providers, and the fragment is
+// evaluated as a JSON pointer. It is registered for "$ref" by `New`.
+var JSONReference KeywordHandler = jsonReference{}
+
+type jsonReference struct{}
+
+func (jsonReference) ResolveReference(ctx *ReferenceContext, ref string) (interface{}, error) {
+	return ctx.Resolve(ref)
+}
+
+type keyword struct {
+	name    string
+	handler KeywordHandler
+}
+
+// ReferenceContext gives KeywordHandlers access to the state of the
+// current resolution.
+type ReferenceContext struct {
+	ctx     *resolveCtx
+	r       *Resolver
+	keyword string
+	node    interface{}
+}
+
+// Keyword returns the name of the keyword under which the reference
+// was found
+func (rctx *ReferenceContext) Keyword() string {
+	return rctx.keyword
+}
+
+// Node returns the object that contains the reference keyword
+func (rctx *ReferenceContext) Node() interface{} {
+	return rctx.node
+}
+
+// Document returns the document that contains the reference, which
+// is the value passed to `Resolve` or a document fetched through one
+// of the providers.
+func (rctx *ReferenceContext) Document() interface{} {
+	return rctx.ctx.object
+}
+
+// Resolve resolves `ref` using the JSON Reference semantics, relative
+// to the document that contains the reference being handled.
+func (rctx *ReferenceContext) Resolve(ref string) (interface{}, error) {
+	return expandRef(rctx.ctx, rctx.r, ref)
+}
+
+// AddKeyword registers a reference keyword. Objects that contain
+// the keyword with a string value are replaced by the value
+// returned by `h`. Keywords are looked up in the order they were
+// added, with "$ref" always being the first. If `name` has already
+// been registered, its handler is replaced.
+func (r *Resolver) AddKeyword(name string, h KeywordHandler) error {
+	if name == "" {
+		return errors.New("keyword name must not be empty")
+	}
+	if h == nil {
+		return errors.New("keyword handler must not be nil")
+	}
+
+	if len(r.keywords) == 0 {
+		r.keywords = r.keywordList()
+	}
+
+	for i, kw := range r.keywords {
+		if kw.name == name {
+			r.keywords[i] = &keyword{name: name, handler: h}
+			return nil
+		}
+	}
+	r.keywords = append(r.keywords, &keyword{name: name, handler: h})
+	return nil
+}
+
+func (r *Resolver) keywordList() []*keyword {
+	if len(r.keywords) == 0 {
+		return []*keyword{{name: ref, handler: JSONReference}}
+	}
+	return r.keywords
+}
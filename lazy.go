@@ -0,0 +1,295 @@
+package jsref
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// Node is a lazily resolved view of a value, returned by `Resolve`
+// when the `WithLazyResolution` option is given. The references
+// in the children of a Node are only resolved when the children are
+// accessed, and the result is cached.
+//
+// Children that resolve to the same location share the same Node, so
+// cyclic structures can be navigated without expanding them. Values
+// that keys next to "$ref" were merged into are not shared, since
+// they differ from the value at their location.
+type Node struct {
+	lazy     *lazyState
+	ctx      *resolveCtx // context of the document holding the value
+	value    interface{}
+	location *Location // nil if unknown
+
+	mu       sync.Mutex
+	children map[string]*Node
+}
+
+// lazyState is shared by all the Nodes created by a single call to
+// `Resolve`
+type lazyState struct {
+	r     *Resolver
+	mu    sync.Mutex
+	nodes map[string]*Node // by location of their value
+}
+
+func newLazyNode(r *Resolver, ctx *resolveCtx, loc *Location, v interface{}) *Node {
+	lazy := &lazyState{
+		r:     r,
+		nodes: make(map[string]*Node),
+	}
+	return lazy.node(ctx, v, loc)
+}
+
+// node returns the Node for `v`, found at `loc` in the document of
+// `ctx`. Nodes are shared when the location is known.
+func (lazy *lazyState) node(ctx *resolveCtx, v interface{}, loc *Location) *Node {
+	n := &Node{
+		lazy:     lazy,
+		ctx:      ctx,
+		value:    v,
+		location: loc,
+	}
+	if loc == nil || ctx.siblings != IgnoreSiblings {
+		return n
+	}
+
+	lazy.mu.Lock()
+	defer lazy.mu.Unlock()
+	key := loc.String()
+	if x, ok := lazy.nodes[key]; ok {
+		return x
+	}
+	lazy.nodes[key] = n
+	return n
+}
+
+// Value returns the value of the node. References in its children
+// are left as they are.
+func (n *Node) Value() interface{} {
+	return n.value
+}
+
+// Location returns where the value of the node originates from. The
+// `Refs` of the location only list the references that were followed
+// to reach this node from its parent.
+func (n *Node) Location() Location {
+	if n.location == nil {
+		return Location{}
+	}
+	return *n.location
+}
+
+// Len returns the number of children of the node, or 0 if it is
+// neither an object nor an array
+func (n *Node) Len() int {
+	if om, ok := n.value.(*OrderedMap); ok {
+		return om.Len()
+	}
+
+	rv := reflect.ValueOf(n.value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return rv.Len()
+	case reflect.Struct:
+		return len(n.Keys())
+	}
+	return 0
+}
+
+// Keys returns the keys of the node if it is an object, or nil.
+// Keys of an `*OrderedMap` are returned in order, keys of maps are
+// sorted.
+func (n *Node) Keys() []string {
+	if om, ok := n.value.(*OrderedMap); ok {
+		return om.Keys()
+	}
+
+	rv := reflect.ValueOf(n.value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, mapKeyToken(key))
+		}
+		sort.Strings(keys)
+		return keys
+	case reflect.Struct:
+		var keys []string
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			keys = append(keys, structFieldToken(rv.Type(), i))
+		}
+		return keys
+	}
+	return nil
+}
+
+// Get returns the child of the node under `key`, resolving it if it
+// is a reference
+func (n *Node) Get(key string) (*Node, error) {
+	return n.child(key)
+}
+
+// Index returns the i-th element of the node, resolving it if it is
+// a reference
+func (n *Node) Index(i int) (*Node, error) {
+	return n.child(strconv.Itoa(i))
+}
+
+// JSONGet allows `EvalPointer` to walk through nodes, resolving the
+// references along the way
+func (n *Node) JSONGet(tok string) (interface{}, error) {
+	return n.child(tok)
+}
+
+func (n *Node) child(tok string) (ret *Node, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("Node.child(%s)", tok).BindError(&err)
+		defer g.End()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if x, ok := n.children[tok]; ok {
+		return x, nil
+	}
+
+	v, err := pointerChild(n.value, tok)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every access is resolved with a fresh context, so that
+	// references visited while accessing other nodes are not
+	// mistaken for loops
+	ctx := &resolveCtx{}
+	*ctx = *n.ctx
+	ctx.rlevel = 0
+	ctx.seen = nil
+	ctx.path = nil
+	ctx.trail = nil
+	ctx.holder = nil
+	ctx.located = nil
+	if n.location != nil {
+		ctx.located = &Location{
+			Document: n.location.Document,
+			Pointer:  n.location.Pointer + "/" + EscapePointerToken(tok),
+		}
+	}
+
+	v, err = expandRefRecursive(ctx, n.lazy.r, v)
+	if err != nil {
+		return nil, err
+	}
+
+	holder := ctx.holder
+	if holder == nil {
+		holder = n.ctx
+	}
+	child := n.lazy.node(holder, v, ctx.located)
+
+	if n.children == nil {
+		n.children = make(map[string]*Node)
+	}
+	n.children[tok] = child
+	return child, nil
+}
+
+// Expand returns the value of the node with all references resolved.
+// ErrReferenceLoop is returned if the node contains itself.
+func (n *Node) Expand() (interface{}, error) {
+	return n.expand(map[interface{}]bool{})
+}
+
+// expand expands the node. Nodes being expanded are identified by
+// their location, or by themselves if it is unknown.
+func (n *Node) expand(visiting map[interface{}]bool) (interface{}, error) {
+	var id interface{} = n
+	if n.location != nil {
+		id = n.location.String()
+	}
+	if visiting[id] {
+		return nil, ErrReferenceLoop
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+
+	if om, ok := n.value.(*OrderedMap); ok {
+		out := NewOrderedMap()
+		for _, key := range om.Keys() {
+			v, err := n.expandChild(key, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out.Set(key, v)
+		}
+		return out, nil
+	}
+
+	rv := reflect.ValueOf(n.value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Struct:
+		out := make(map[string]interface{})
+		for _, key := range n.Keys() {
+			v, err := n.expandChild(key, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			v, err := n.expandChild(strconv.Itoa(i), visiting)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return n.value, nil
+}
+
+func (n *Node) expandChild(tok string, visiting map[interface{}]bool) (interface{}, error) {
+	child, err := n.child(tok)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve %q", tok)
+	}
+	return child.expand(visiting)
+}
+
+// MarshalJSON marshals the fully expanded value of the node
+func (n *Node) MarshalJSON() ([]byte, error) {
+	v, err := n.Expand()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,131 @@
+package jsref
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+)
+
+// Limits caps the amount of work done by a single call to `Resolve`,
+// so that untrusted documents can be processed safely. A zero value
+// for any of the fields means that there is no limit.
+type Limits struct {
+	// MaxReferences is the maximum number of references expanded
+	MaxReferences int
+	// MaxDocuments is the maximum number of distinct external
+	// documents loaded from the providers
+	MaxDocuments int
+	// MaxBytes is the maximum total size of the external documents
+	// loaded from the providers. It is checked once each document is
+	// loaded, using the size reported by providers that implement
+	// `SizeProvider`, or the size of raw JSON documents. Documents of
+	// unknown size are not counted. To stop reading a document as soon
+	// as it is too large, create the providers with
+	// `provider.WithMaxBytes`.
+	MaxBytes int64
+	// MaxNodes is the maximum number of values visited while
+	// recursively resolving the result.
+	MaxNodes int
+}
+
+// LimitError is returned by `Resolve` when one of the `Limits` is
+// exceeded, and by the providers created with `provider.WithMaxBytes`
+// when a document is too large
+type LimitError = jsondoc.LimitError
+
+// SizeProvider is implemented by Providers that can report the size
+// in bytes of the source of the documents they return
+type SizeProvider interface {
+	Size(*url.URL) (int64, bool)
+}
+
+// usage tracks the work done by a single call to `Resolve`, and
+// enforces the limits
+type usage struct {
+	mu     sync.Mutex
+	limits Limits
+	refs   int
+	nodes  int
+	bytes  int64
+	docs   map[string]struct{}
+}
+
+func newUsage(limits Limits) *usage {
+	return &usage{
+		limits: limits,
+		docs:   make(map[string]struct{}),
+	}
+}
+
+func (u *usage) reference() error {
+	if u.limits.MaxReferences <= 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.refs++
+	if u.refs > u.limits.MaxReferences {
+		return &LimitError{Limit: "references", Max: int64(u.limits.MaxReferences)}
+	}
+	return nil
+}
+
+func (u *usage) node() error {
+	if u.limits.MaxNodes <= 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.nodes++
+	if u.nodes > u.limits.MaxNodes {
+		return &LimitError{Limit: "nodes", Max: int64(u.limits.MaxNodes)}
+	}
+	return nil
+}
+
+// document accounts for the document `v` loaded from `p`. Documents
+// are only counted the first time they are loaded.
+func (u *usage) document(p Provider, loc *url.URL, v interface{}) error {
+	if u.limits.MaxDocuments <= 0 && u.limits.MaxBytes <= 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := loc.String()
+	if _, ok := u.docs[key]; ok {
+		return nil
+	}
+	u.docs[key] = struct{}{}
+
+	if u.limits.MaxDocuments > 0 && len(u.docs) > u.limits.MaxDocuments {
+		return &LimitError{Limit: "documents", Max: int64(u.limits.MaxDocuments)}
+	}
+
+	if u.limits.MaxBytes > 0 {
+		if n, ok := documentSize(p, loc, v); ok {
+			u.bytes += n
+		}
+		if u.bytes > u.limits.MaxBytes {
+			return &LimitError{Limit: "bytes", Max: u.limits.MaxBytes}
+		}
+	}
+	return nil
+}
+
+// documentSize returns the size of the source of the document `v`
+// loaded from `p`, if it is known
+func documentSize(p Provider, loc *url.URL, v interface{}) (int64, bool) {
+	if raw, ok := v.(json.RawMessage); ok {
+		return int64(len(raw)), true
+	}
+	if sp, ok := p.(SizeProvider); ok {
+		return sp.Size(loc)
+	}
+	return 0, false
+}
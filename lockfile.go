@@ -0,0 +1,352 @@
+package jsref
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// LockMode specifies how a Lockfile is used while resolving
+type LockMode int
+
+const (
+	// LockVerify checks the external documents against the Lockfile.
+	// Documents that are missing from the Lockfile, or whose content
+	// differs, cause an IntegrityError.
+	LockVerify LockMode = iota
+	// LockUpdate records the external documents in the Lockfile,
+	// replacing the previous entries for the same URLs
+	LockUpdate
+)
+
+// lockfileVersion is the version of the lockfile format
+const lockfileVersion = 1
+
+// Lockfile pins the content of the external documents loaded through
+// the providers. Each document is identified by its normalized URL,
+// and its content by the SHA-256 digest of its canonical JSON
+// encoding, in which object keys are sorted and insignificant white
+// space is removed, so that reformatting a document does not change
+// its digest.
+//
+// A Lockfile is safe for concurrent use.
+type Lockfile struct {
+	mu      sync.Mutex
+	digests map[string]string // by normalized URL
+}
+
+type lockfileJSON struct {
+	Version   int                          `json:"version"`
+	Documents map[string]lockfileEntryJSON `json:"documents"`
+}
+
+type lockfileEntryJSON struct {
+	SHA256 string `json:"sha256"`
+}
+
+// NewLockfile creates an empty Lockfile
+func NewLockfile() *Lockfile {
+	return &Lockfile{digests: make(map[string]string)}
+}
+
+// ReadLockfile reads a Lockfile written by `WriteTo`
+func ReadLockfile(src io.Reader) (*Lockfile, error) {
+	var v lockfileJSON
+	if err := json.NewDecoder(src).Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "failed to decode lockfile")
+	}
+	if v.Version != lockfileVersion {
+		return nil, errors.Errorf("unsupported lockfile version %d", v.Version)
+	}
+
+	l := NewLockfile()
+	for u, entry := range v.Documents {
+		l.digests[u] = entry.SHA256
+	}
+	return l, nil
+}
+
+// LoadLockfile reads the Lockfile at `filename`
+func LoadLockfile(filename string) (*Lockfile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open lockfile")
+	}
+	defer f.Close()
+	return ReadLockfile(f)
+}
+
+// WriteTo writes the Lockfile to `dst` as JSON, with its entries
+// sorted by URL
+func (l *Lockfile) WriteTo(dst io.Writer) (int64, error) {
+	l.mu.Lock()
+	v := lockfileJSON{
+		Version:   lockfileVersion,
+		Documents: make(map[string]lockfileEntryJSON, len(l.digests)),
+	}
+	for u, digest := range l.digests {
+		v.Documents[u] = lockfileEntryJSON{SHA256: digest}
+	}
+	l.mu.Unlock()
+
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode lockfile")
+	}
+	n, err := dst.Write(append(buf, '\n'))
+	return int64(n), err
+}
+
+// Save writes the Lockfile to `filename`
+func (l *Lockfile) Save(filename string) error {
+	var buf bytes.Buffer
+	if _, err := l.WriteTo(&buf); err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(filename, buf.Bytes(), 0644), "failed to write lockfile")
+}
+
+// URLs returns the URLs of the documents in the Lockfile, sorted
+func (l *Lockfile) URLs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	urls := make([]string, 0, len(l.digests))
+	for u := range l.digests {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Digest returns the hex encoded SHA-256 digest recorded for the
+// document at `u`
+func (l *Lockfile) Digest(u string) (string, bool) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	digest, ok := l.digests[normalizeURL(pu)]
+	return digest, ok
+}
+
+// IntegrityError is returned by `Resolve` when an external document
+// does not match the Lockfile given with `WithLockfile`
+type IntegrityError struct {
+	// URL is the normalized URL of the document
+	URL string
+	// Expected is the digest recorded in the Lockfile, or the empty
+	// string if the document is not in the Lockfile
+	Expected string
+	// Actual is the digest of the document that was loaded
+	Actual string
+}
+
+func (e *IntegrityError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("%s: %s is not in the lockfile", ErrIntegrity, e.URL)
+	}
+	return fmt.Sprintf("%s: %s has sha256 %s, expected %s", ErrIntegrity, e.URL, e.Actual, e.Expected)
+}
+
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+// lockState applies a Lockfile during a single call to `Resolve`.
+// Each document is only checked the first time it is loaded.
+type lockState struct {
+	lockfile *Lockfile
+	mode     LockMode
+
+	mu      sync.Mutex
+	checked map[string]struct{}
+}
+
+func newLockState(l *Lockfile, mode LockMode) *lockState {
+	if l == nil {
+		return nil
+	}
+	return &lockState{
+		lockfile: l,
+		mode:     mode,
+		checked:  make(map[string]struct{}),
+	}
+}
+
+func (ls *lockState) document(u *url.URL, v interface{}) error {
+	if ls == nil {
+		return nil
+	}
+
+	key := normalizeURL(u)
+	ls.mu.Lock()
+	if _, ok := ls.checked[key]; ok {
+		ls.mu.Unlock()
+		return nil
+	}
+	ls.checked[key] = struct{}{}
+	ls.mu.Unlock()
+
+	digest, err := documentDigest(v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute the digest of %s", key)
+	}
+
+	l := ls.lockfile
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ls.mode == LockUpdate {
+		l.digests[key] = digest
+		return nil
+	}
+	if expected := l.digests[key]; expected != digest {
+		return &IntegrityError{URL: key, Expected: expected, Actual: digest}
+	}
+	return nil
+}
+
+// normalizeURL returns the form of `u` that identifies a document in
+// a Lockfile: the scheme and host are lower cased, default ports,
+// dot segments and the fragment are removed.
+func normalizeURL(u *url.URL) string {
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	n.Scheme = strings.ToLower(n.Scheme)
+	host := strings.ToLower(n.Host)
+	switch {
+	case n.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		host = strings.TrimSuffix(host, ":80")
+	case n.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		host = strings.TrimSuffix(host, ":443")
+	}
+	n.Host = host
+	if n.Path != "" {
+		p := path.Clean(n.Path)
+		if strings.HasSuffix(n.Path, "/") && p != "/" {
+			p += "/"
+		}
+		n.Path = p
+		n.RawPath = ""
+	}
+	return n.String()
+}
+
+// documentDigest returns the hex encoded SHA-256 digest of the
+// canonical JSON encoding of `v`
+func documentDigest(v interface{}) (string, error) {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if err := writeCanonicalJSON(h, x); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var integerRx = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// writeCanonicalJSON writes `v`, a value decoded with `UseNumber`,
+// with sorted object keys and without white space. Integers are
+// written as they are, other numbers in their shortest form.
+func writeCanonicalJSON(dst io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		io.WriteString(dst, "{")
+		for i, key := range keys {
+			if i > 0 {
+				io.WriteString(dst, ",")
+			}
+			if err := writeCanonicalJSON(dst, key); err != nil {
+				return err
+			}
+			io.WriteString(dst, ":")
+			if err := writeCanonicalJSON(dst, v[key]); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(dst, "}")
+		return err
+	case []interface{}:
+		io.WriteString(dst, "[")
+		for i, elem := range v {
+			if i > 0 {
+				io.WriteString(dst, ",")
+			}
+			if err := writeCanonicalJSON(dst, elem); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(dst, "]")
+		return err
+	case json.Number:
+		s := string(v)
+		if integerRx.MatchString(s) {
+			if s == "-0" {
+				s = "0"
+			}
+			_, err := io.WriteString(dst, s)
+			return err
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(dst, strconv.FormatFloat(f, 'g', -1, 64))
+		return err
+	case string:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		_, err := dst.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		return err
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(buf)
+	return err
+}
@@ -0,0 +1,60 @@
+package openapi
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors that describe why a reference in an OpenAPI document is
+// invalid. They can be matched against a *ReferenceError using
+// `errors.Is`.
+var (
+	// ErrUnresolvable is reported when the target of a reference
+	// could not be found
+	ErrUnresolvable = errors.New("reference could not be resolved")
+	// ErrCircularReference is reported by `Dereference` when a
+	// reference points back to one of the objects that contain it
+	ErrCircularReference = errors.New("circular reference")
+	// ErrSiblings is reported in strict mode when a Reference Object
+	// contains keys that the specification does not allow
+	ErrSiblings = errors.New("reference object contains sibling keys")
+	// ErrComponentMismatch is reported when a reference to
+	// "#/components/..." points to a section that does not hold
+	// objects of the type expected at the location of the reference
+	ErrComponentMismatch = errors.New("reference points to the wrong component type")
+	// ErrNotOpenAPI is returned for documents that do not declare a
+	// supported "openapi" version
+	ErrNotOpenAPI = errors.New("document is not an OpenAPI 3.0 or 3.1 document")
+)
+
+// ReferenceError describes an invalid reference in an OpenAPI document
+type ReferenceError struct {
+	// Document is the URI of the document that contains the
+	// reference. It is empty for the document being processed.
+	Document string
+	// Pointer is the JSON pointer to the object that contains the
+	// reference within Document
+	Pointer string
+	// Ref is the reference itself
+	Ref string
+	// Err is the reason why the reference is invalid
+	Err error
+}
+
+func (e *ReferenceError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid reference '")
+	b.WriteString(e.Ref)
+	b.WriteString("' at ")
+	b.WriteString(e.Document)
+	b.WriteString("#")
+	b.WriteString(e.Pointer)
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return e.Err
+}
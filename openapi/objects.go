@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	"sort"
+
+	"github.com/lestrrat-go/jsref"
+)
+
+// The functions in this file allow the rest of the package to work
+// with objects regardless of whether they were decoded as
+// map[string]interface{} or *jsref.OrderedMap
+
+func isObject(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, *jsref.OrderedMap:
+		return true
+	}
+	return false
+}
+
+// newObjectLike creates an empty object of the same kind as `v`
+func newObjectLike(v interface{}) interface{} {
+	if _, ok := v.(*jsref.OrderedMap); ok {
+		return jsref.NewOrderedMap()
+	}
+	return make(map[string]interface{})
+}
+
+// objectKeys returns the keys of `v`: in order for *jsref.OrderedMap,
+// sorted for maps
+func objectKeys(v interface{}) []string {
+	switch v := v.(type) {
+	case *jsref.OrderedMap:
+		return v.Keys()
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	return nil
+}
+
+func objectGet(v interface{}, key string) (interface{}, bool) {
+	switch v := v.(type) {
+	case *jsref.OrderedMap:
+		return v.Get(key)
+	case map[string]interface{}:
+		x, ok := v[key]
+		return x, ok
+	}
+	return nil, false
+}
+
+func objectSet(v interface{}, key string, value interface{}) {
+	switch v := v.(type) {
+	case *jsref.OrderedMap:
+		v.Set(key, value)
+	case map[string]interface{}:
+		v[key] = value
+	}
+}
+
+func objectString(v interface{}, key string) (string, bool) {
+	x, ok := objectGet(v, key)
+	if !ok {
+		return "", false
+	}
+	s, ok := x.(string)
+	return s, ok
+}
@@ -0,0 +1,185 @@
+// Package openapi resolves references in OpenAPI 3.0 and 3.1 documents,
+// following the rules that the OpenAPI specification layers on top of
+// JSON Reference.
+package openapi
+
+import (
+	"strings"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/option"
+	"github.com/lestrrat-go/pdebug"
+)
+
+type Option = option.Interface
+
+type identStrict struct{}
+type identBaseURI struct{}
+
+// WithStrict specifies that Reference Objects that contain keys
+// the specification does not allow should be reported as errors
+// (ErrSiblings), instead of being silently ignored.
+func WithStrict(b bool) Option {
+	return option.New(identStrict{}, b)
+}
+
+// WithBaseURI specifies the URI of the document being processed.
+// Relative references in the document are resolved against it
+// before being handed to the providers.
+func WithBaseURI(s string) Option {
+	return option.New(identBaseURI{}, s)
+}
+
+// Resolver resolves references in OpenAPI documents. External
+// documents are loaded through the providers registered in the
+// underlying `jsref.Resolver`.
+type Resolver struct {
+	resolver *jsref.Resolver
+	strict   bool
+}
+
+// New creates a new Resolver that loads external documents using `r`
+func New(r *jsref.Resolver, options ...Option) *Resolver {
+	oa := &Resolver{resolver: r}
+	for _, option := range options {
+		switch option.Ident() {
+		case identStrict{}:
+			oa.strict = option.Value().(bool)
+		}
+	}
+	return oa
+}
+
+// Load fetches the document at `uri` using the providers of the
+// underlying `jsref.Resolver`
+func (oa *Resolver) Load(uri string) (interface{}, error) {
+	return oa.resolver.Resolve(map[string]interface{}{"$ref": uri}, "")
+}
+
+// Dereference returns a copy of `doc` where every reference has been
+// replaced by the object it points to. `doc` itself is not modified.
+//
+// Path Item Objects are merged with the Path Item they reference, with
+// the keys of the referencing object taking precedence. In OpenAPI 3.1,
+// the "summary" and "description" keys of a Reference Object override
+// those of the referenced object, and keys next to "$ref" in Schema
+// Objects are merged into the referenced schema. Other keys next to
+// "$ref" are ignored, or reported as ErrSiblings in strict mode.
+//
+// Values of "externalValue" in Example Objects are left untouched, and
+// "operationRef" in Link Objects is verified to point to an existing
+// object but is not replaced. Documents with circular references cannot
+// be dereferenced, and ErrCircularReference is reported.
+func (oa *Resolver) Dereference(doc interface{}, options ...Option) (interface{}, error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("openapi.Resolver.Dereference")
+		defer g.End()
+	}
+
+	w, err := oa.newWalker(doc, false, options)
+	if err != nil {
+		return nil, err
+	}
+	return w.walk(doc, fieldType{typeDocument, single}, w.base, "")
+}
+
+// Bundle returns a copy of `doc` where every reference to an external
+// document has been replaced by a reference to a new entry under
+// "#/components", so that the result is self contained. References
+// local to `doc` are kept as they are. `doc` itself is not modified.
+//
+// Components are named after the last token of the JSON pointer in the
+// reference, or after the name of the document if the reference has no
+// fragment. Names that are already used are suffixed with a number.
+// Objects that have no corresponding components section, such as Path
+// Items in OpenAPI 3.0, are inlined instead.
+func (oa *Resolver) Bundle(doc interface{}, options ...Option) (interface{}, error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("openapi.Resolver.Bundle")
+		defer g.End()
+	}
+
+	w, err := oa.newWalker(doc, true, options)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := w.walk(doc, fieldType{typeDocument, single}, w.base, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(w.components) == 0 {
+		return out, nil
+	}
+
+	comps, ok := objectGet(out, "components")
+	if !ok {
+		comps = newObjectLike(out)
+		objectSet(out, "components", comps)
+	}
+	for _, section := range w.sections {
+		sec, ok := objectGet(comps, section)
+		if !ok {
+			sec = newObjectLike(out)
+			objectSet(comps, section, sec)
+		}
+		for _, entry := range w.components[section] {
+			objectSet(sec, entry.name, entry.value)
+		}
+	}
+	return out, nil
+}
+
+func (oa *Resolver) newWalker(doc interface{}, bundle bool, options []Option) (*walker, error) {
+	s, _ := objectString(doc, "openapi")
+	var version string
+	switch {
+	case strings.HasPrefix(s, "3.0."), s == "3.0":
+		version = "3.0"
+	case strings.HasPrefix(s, "3.1."), s == "3.1":
+		version = "3.1"
+	default:
+		return nil, ErrNotOpenAPI
+	}
+
+	w := &walker{
+		oa:         oa,
+		root:       doc,
+		version:    version,
+		bundle:     bundle,
+		strict:     oa.strict,
+		docs:       make(map[string]interface{}),
+		bundled:    make(map[string]string),
+		components: make(map[string][]component),
+		used:       make(map[string]bool),
+	}
+	for _, option := range options {
+		switch option.Ident() {
+		case identStrict{}:
+			w.strict = option.Value().(bool)
+		case identBaseURI{}:
+			w.base = option.Value().(string)
+		}
+	}
+
+	// Names that are already taken in the document can't be
+	// used for bundled components
+	if comps, ok := objectGet(doc, "components"); ok {
+		for _, section := range objectKeys(comps) {
+			sec, _ := objectGet(comps, section)
+			for _, name := range objectKeys(sec) {
+				w.used[section+"/"+name] = true
+			}
+		}
+	}
+	return w, nil
+}
+
+// splitRef splits a reference into the document URI and the fragment
+func splitRef(ref string) (string, string) {
+	if i := strings.IndexByte(ref, '#'); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
@@ -0,0 +1,289 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/openapi"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+const petsJSON = `{
+  "Pet": {
+    "type": "object",
+    "properties": {
+      "owner": {"$ref": "#/Owner"}
+    }
+  },
+  "Owner": {"type": "string"},
+  "User": {"type": "integer"}
+}`
+
+const specJSON = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/users": {
+      "get": {
+        "responses": {
+          "200": {"$ref": "#/components/responses/UserList"}
+        },
+        "links": {}
+      }
+    },
+    "/alias": {"$ref": "#/paths/~1users", "summary": "alias"}
+  },
+  "components": {
+    "responses": {
+      "UserList": {
+        "description": "users",
+        "content": {
+          "application/json": {
+            "schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}},
+            "examples": {"big": {"externalValue": "https://example.com/users.json"}}
+          }
+        },
+        "links": {
+          "self": {"operationRef": "#/paths/~1users/get"}
+        }
+      }
+    },
+    "schemas": {
+      "User": {
+        "type": "object",
+        "properties": {
+          "pet": {"$ref": "pets.json#/Pet"},
+          "other": {"$ref": "pets.json#/User"},
+          "enum": {"enum": [{"$ref": "not a reference"}]}
+        }
+      }
+    }
+  }
+}`
+
+func newResolver(t *testing.T) (*openapi.Resolver, bool) {
+	var pets interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(petsJSON), &pets), `json.Unmarshal should succeed`) {
+		return nil, false
+	}
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("pets.json", pets), `mp.Set("pets.json") should succeed`) {
+		return nil, false
+	}
+
+	r := jsref.New()
+	if !assert.NoError(t, r.AddProvider(mp), `r.AddProvider() should succeed`) {
+		return nil, false
+	}
+	return openapi.New(r), true
+}
+
+func decode(t *testing.T, src string) interface{} {
+	var v interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(src), &v), `json.Unmarshal should succeed`) {
+		t.FailNow()
+	}
+	return v
+}
+
+func TestDereference(t *testing.T) {
+	oa, ok := newResolver(t)
+	if !ok {
+		return
+	}
+
+	doc := decode(t, specJSON)
+	out, err := oa.Dereference(doc)
+	if !assert.NoError(t, err, `Dereference should succeed`) {
+		return
+	}
+
+	data := map[string]interface{}{
+		"#/paths/~1users/get/responses/200/description":                                                                 "users",
+		"#/paths/~1users/get/responses/200/content/application~1json/schema/items/properties/pet/properties/owner/type": "string",
+		"#/paths/~1users/get/responses/200/content/application~1json/schema/items/properties/other/type":                "integer",
+		"#/paths/~1alias/summary":                       "alias",
+		"#/paths/~1alias/get/responses/200/description": "users",
+		"#/components/responses/UserList/content/application~1json/examples/big/externalValue": "https://example.com/users.json",
+		"#/components/responses/UserList/links/self/operationRef":                              "#/paths/~1users/get",
+		"#/components/schemas/User/properties/enum/enum/0/$ref":                                "not a reference",
+	}
+	for ptr, expected := range data {
+		v, err := jsref.EvalPointer(out, ptr)
+		if !assert.NoError(t, err, `EvalPointer(%s) should succeed`, ptr) {
+			return
+		}
+		if !assert.Equal(t, expected, v, `EvalPointer(%s) should match`, ptr) {
+			return
+		}
+	}
+
+	// The original document is left untouched
+	v, err := jsref.EvalPointer(doc, "#/paths/~1users/get/responses/200/$ref")
+	if !assert.NoError(t, err, `EvalPointer should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "#/components/responses/UserList", v) {
+		return
+	}
+}
+
+func TestBundle(t *testing.T) {
+	oa, ok := newResolver(t)
+	if !ok {
+		return
+	}
+
+	out, err := oa.Bundle(decode(t, specJSON))
+	if !assert.NoError(t, err, `Bundle should succeed`) {
+		return
+	}
+
+	b, err := json.Marshal(out)
+	if !assert.NoError(t, err, `json.Marshal should succeed`) {
+		return
+	}
+	if !assert.False(t, strings.Contains(string(b), "pets.json"), `bundled document should not refer to pets.json`) {
+		return
+	}
+
+	data := map[string]interface{}{
+		"#/components/schemas/User/properties/pet/$ref":   "#/components/schemas/Pet",
+		"#/components/schemas/User/properties/other/$ref": "#/components/schemas/User1",
+		"#/components/schemas/Pet/properties/owner/$ref":  "#/components/schemas/Owner",
+		"#/components/schemas/Owner/type":                 "string",
+		"#/components/schemas/User1/type":                 "integer",
+		"#/paths/~1users/get/responses/200/$ref":          "#/components/responses/UserList",
+		"#/paths/~1alias/$ref":                            "#/paths/~1users",
+	}
+	for ptr, expected := range data {
+		v, err := jsref.EvalPointer(out, ptr)
+		if !assert.NoError(t, err, `EvalPointer(%s) should succeed`, ptr) {
+			return
+		}
+		if !assert.Equal(t, expected, v, `EvalPointer(%s) should match`, ptr) {
+			return
+		}
+	}
+}
+
+func TestReferenceErrors(t *testing.T) {
+	oa, ok := newResolver(t)
+	if !ok {
+		return
+	}
+
+	data := []struct {
+		Name     string
+		Src      string
+		Options  []openapi.Option
+		Bundle   bool
+		Expected error
+	}{
+		{
+			Name:     "not an OpenAPI document",
+			Src:      `{"swagger": "2.0"}`,
+			Expected: openapi.ErrNotOpenAPI,
+		},
+		{
+			Name:     "parameter pointing to a schema",
+			Src:      `{"openapi": "3.0.0", "paths": {"/": {"parameters": [{"$ref": "#/components/schemas/X"}]}}, "components": {"schemas": {"X": {}}}}`,
+			Expected: openapi.ErrComponentMismatch,
+		},
+		{
+			Name:     "siblings in strict mode",
+			Src:      `{"openapi": "3.0.0", "components": {"responses": {"A": {"description": "a"}, "B": {"$ref": "#/components/responses/A", "description": "b"}}}}`,
+			Options:  []openapi.Option{openapi.WithStrict(true)},
+			Expected: openapi.ErrSiblings,
+		},
+		{
+			Name:     "circular schema",
+			Src:      `{"openapi": "3.0.0", "components": {"schemas": {"Node": {"properties": {"next": {"$ref": "#/components/schemas/Node"}}}}}}`,
+			Expected: openapi.ErrCircularReference,
+		},
+		{
+			Name:     "broken reference",
+			Src:      `{"openapi": "3.0.0", "components": {"schemas": {"A": {"$ref": "#/components/schemas/B"}}}}`,
+			Expected: openapi.ErrUnresolvable,
+		},
+		{
+			Name:     "broken operationRef",
+			Src:      `{"openapi": "3.0.0", "components": {"links": {"A": {"operationRef": "#/paths/~1nowhere/get"}}}}`,
+			Expected: openapi.ErrUnresolvable,
+		},
+		{
+			Name:     "broken external reference in bundle",
+			Src:      `{"openapi": "3.0.0", "components": {"schemas": {"A": {"$ref": "pets.json#/Nothing"}}}}`,
+			Bundle:   true,
+			Expected: openapi.ErrUnresolvable,
+		},
+	}
+
+	for _, set := range data {
+		var err error
+		if set.Bundle {
+			_, err = oa.Bundle(decode(t, set.Src), set.Options...)
+		} else {
+			_, err = oa.Dereference(decode(t, set.Src), set.Options...)
+		}
+		if !assert.Error(t, err, `%s: should fail`, set.Name) {
+			return
+		}
+		if !assert.True(t, errors.Is(err, set.Expected), `%s: expected %s, got %s`, set.Name, set.Expected, err) {
+			return
+		}
+	}
+
+	// Cycles are fine when bundling
+	_, err := oa.Bundle(decode(t, `{"openapi": "3.0.0", "components": {"schemas": {"Node": {"properties": {"next": {"$ref": "#/components/schemas/Node"}}}}}}`))
+	if !assert.NoError(t, err, `Bundle with cycles should succeed`) {
+		return
+	}
+}
+
+func TestOpenAPI31Siblings(t *testing.T) {
+	oa, ok := newResolver(t)
+	if !ok {
+		return
+	}
+
+	src := `{
+  "openapi": "3.1.0",
+  "components": {
+    "responses": {
+      "A": {"description": "a", "content": {}},
+      "B": {"$ref": "#/components/responses/A", "description": "b", "content": {"ignored": {}}}
+    },
+    "schemas": {
+      "S": {"type": "string"},
+      "T": {"$ref": "#/components/schemas/S", "maxLength": 10}
+    }
+  }
+}`
+	out, err := oa.Dereference(decode(t, src))
+	if !assert.NoError(t, err, `Dereference should succeed`) {
+		return
+	}
+
+	expected := decode(t, `{
+  "responses": {
+    "A": {"description": "a", "content": {}},
+    "B": {"description": "b", "content": {}}
+  },
+  "schemas": {
+    "S": {"type": "string"},
+    "T": {"type": "string", "maxLength": 10}
+  }
+}`)
+	v, err := jsref.EvalPointer(out, "#/components")
+	if !assert.NoError(t, err, `EvalPointer should succeed`) {
+		return
+	}
+	if !assert.Equal(t, expected, v) {
+		return
+	}
+}
@@ -0,0 +1,174 @@
+package openapi
+
+import "strings"
+
+// nodeType identifies the kind of OpenAPI object found at a given
+// location, which determines how references found there are treated
+type nodeType int
+
+const (
+	typeAny nodeType = iota
+	typeOpaque
+	typeDocument
+	typeComponents
+	typePaths
+	typePathItem
+	typeOperation
+	typeParameter
+	typeRequestBody
+	typeResponses
+	typeResponse
+	typeMediaType
+	typeEncoding
+	typeHeader
+	typeExample
+	typeLink
+	typeCallback
+	typeSecurityScheme
+	typeSchema
+)
+
+// componentSections maps object types to the section under
+// "#/components" where objects of that type are stored
+var componentSections = map[nodeType]string{
+	typeSchema:         "schemas",
+	typeResponse:       "responses",
+	typeParameter:      "parameters",
+	typeExample:        "examples",
+	typeRequestBody:    "requestBodies",
+	typeHeader:         "headers",
+	typeSecurityScheme: "securitySchemes",
+	typeLink:           "links",
+	typeCallback:       "callbacks",
+	typePathItem:       "pathItems",
+}
+
+// collection denotes whether a field holds a single object, or a
+// map or list of objects
+type collection int
+
+const (
+	single collection = iota
+	many
+)
+
+type fieldType struct {
+	typ  nodeType
+	coll collection
+}
+
+var fieldTypes = map[nodeType]map[string]fieldType{
+	typeDocument: {
+		"paths":      {typePaths, single},
+		"webhooks":   {typePathItem, many},
+		"components": {typeComponents, single},
+	},
+	typeComponents: {
+		"schemas":         {typeSchema, many},
+		"responses":       {typeResponse, many},
+		"parameters":      {typeParameter, many},
+		"examples":        {typeExample, many},
+		"requestBodies":   {typeRequestBody, many},
+		"headers":         {typeHeader, many},
+		"securitySchemes": {typeSecurityScheme, many},
+		"links":           {typeLink, many},
+		"callbacks":       {typeCallback, many},
+		"pathItems":       {typePathItem, many},
+	},
+	typePathItem: {
+		"get":        {typeOperation, single},
+		"put":        {typeOperation, single},
+		"post":       {typeOperation, single},
+		"delete":     {typeOperation, single},
+		"options":    {typeOperation, single},
+		"head":       {typeOperation, single},
+		"patch":      {typeOperation, single},
+		"trace":      {typeOperation, single},
+		"parameters": {typeParameter, many},
+		"servers":    {typeOpaque, single},
+	},
+	typeOperation: {
+		"parameters":  {typeParameter, many},
+		"requestBody": {typeRequestBody, single},
+		"responses":   {typeResponses, single},
+		"callbacks":   {typeCallback, many},
+		"servers":     {typeOpaque, single},
+	},
+	typeParameter: {
+		"schema":   {typeSchema, single},
+		"content":  {typeMediaType, many},
+		"example":  {typeOpaque, single},
+		"examples": {typeExample, many},
+	},
+	typeHeader: {
+		"schema":   {typeSchema, single},
+		"content":  {typeMediaType, many},
+		"example":  {typeOpaque, single},
+		"examples": {typeExample, many},
+	},
+	typeRequestBody: {
+		"content": {typeMediaType, many},
+	},
+	typeResponse: {
+		"headers": {typeHeader, many},
+		"content": {typeMediaType, many},
+		"links":   {typeLink, many},
+	},
+	typeMediaType: {
+		"schema":   {typeSchema, single},
+		"example":  {typeOpaque, single},
+		"examples": {typeExample, many},
+		"encoding": {typeEncoding, many},
+	},
+	typeEncoding: {
+		"headers": {typeHeader, many},
+	},
+	typeExample: {
+		"value": {typeOpaque, single},
+	},
+	typeLink: {
+		"parameters":  {typeOpaque, single},
+		"requestBody": {typeOpaque, single},
+		"server":      {typeOpaque, single},
+	},
+	typeSchema: {
+		"properties":        {typeSchema, many},
+		"patternProperties": {typeSchema, many},
+		"definitions":       {typeSchema, many},
+		"$defs":             {typeSchema, many},
+		"dependentSchemas":  {typeSchema, many},
+		"example":           {typeOpaque, single},
+		"examples":          {typeOpaque, single},
+		"default":           {typeOpaque, single},
+		"const":             {typeOpaque, single},
+		"enum":              {typeOpaque, single},
+	},
+}
+
+// childType returns the type of the value stored under `key` in an
+// object of type `typ`
+func childType(typ nodeType, key string) fieldType {
+	if strings.HasPrefix(key, "x-") {
+		return fieldType{typeOpaque, single}
+	}
+
+	if ft, ok := fieldTypes[typ][key]; ok {
+		return ft
+	}
+
+	switch typ {
+	case typePaths, typeCallback:
+		// Every key is a path (or runtime expression)
+		return fieldType{typePathItem, single}
+	case typeResponses:
+		// Every key is a status code, or "default"
+		return fieldType{typeResponse, single}
+	case typeSchema:
+		// Any other object or list of objects in a schema holds
+		// subschemas ("not", "items", "allOf", ...)
+		return fieldType{typeSchema, single}
+	case typeAny:
+		return fieldType{typeAny, single}
+	}
+	return fieldType{typeOpaque, single}
+}
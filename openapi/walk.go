@@ -0,0 +1,319 @@
+package openapi
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/pkg/errors"
+)
+
+type component struct {
+	name  string
+	value interface{}
+}
+
+// walker holds the state of a single call to Dereference or Bundle
+type walker struct {
+	oa      *Resolver
+	root    interface{}
+	base    string // URI of root
+	version string
+	bundle  bool
+	strict  bool
+
+	docs  map[string]interface{} // external documents, by URI
+	stack []string               // references being dereferenced
+
+	bundled    map[string]string // absolute reference -> local reference
+	components map[string][]component
+	sections   []string        // sections in components, in order of creation
+	used       map[string]bool // section + "/" + name
+}
+
+// walk returns a copy of `node`, with references processed according
+// to the mode of the walker. `base` is the URI of the document that
+// contains `node`, and `ptr` is its location within that document.
+func (w *walker) walk(node interface{}, ft fieldType, base, ptr string) (interface{}, error) {
+	if ft.typ == typeOpaque {
+		return node, nil
+	}
+
+	if l, ok := node.([]interface{}); ok {
+		out := make([]interface{}, len(l))
+		for i, elem := range l {
+			v, err := w.walk(elem, fieldType{ft.typ, single}, base, ptr+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+
+	if !isObject(node) {
+		return node, nil
+	}
+
+	out := newObjectLike(node)
+	if ft.coll == many {
+		for _, key := range objectKeys(node) {
+			child, _ := objectGet(node, key)
+			v, err := w.walk(child, fieldType{ft.typ, single}, base, ptr+"/"+jsref.EscapePointerToken(key))
+			if err != nil {
+				return nil, err
+			}
+			objectSet(out, key, v)
+		}
+		return out, nil
+	}
+
+	if ref, ok := objectString(node, "$ref"); ok {
+		return w.walkRef(node, ref, ft.typ, base, ptr)
+	}
+
+	if ft.typ == typeLink {
+		if err := w.checkOperationRef(node, base, ptr); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range objectKeys(node) {
+		child, _ := objectGet(node, key)
+		v, err := w.walk(child, childType(ft.typ, key), base, ptr+"/"+jsref.EscapePointerToken(key))
+		if err != nil {
+			return nil, err
+		}
+		objectSet(out, key, v)
+	}
+	return out, nil
+}
+
+func (w *walker) walkRef(node interface{}, ref string, typ nodeType, base, ptr string) (interface{}, error) {
+	refError := func(err error) error {
+		return &ReferenceError{Document: w.documentName(base), Pointer: ptr, Ref: ref, Err: err}
+	}
+
+	abs, err := jsref.ResolveURI(base, ref)
+	if err != nil {
+		return nil, refError(errors.Wrap(ErrUnresolvable, err.Error()))
+	}
+	docURI, frag := splitRef(abs)
+
+	if section, ok := componentSections[typ]; ok && strings.HasPrefix(frag, "/components/") {
+		if got := strings.SplitN(strings.TrimPrefix(frag, "/components/"), "/", 2)[0]; got != section {
+			return nil, refError(errors.Wrapf(ErrComponentMismatch, "expected a reference to #/components/%s, got #/components/%s", section, got))
+		}
+	}
+
+	siblings, err := w.siblings(node, typ)
+	if err != nil {
+		return nil, refError(err)
+	}
+
+	if w.bundle {
+		_, hasSection := componentSections[typ]
+		inline := !hasSection || (typ == typePathItem && w.version == "3.0")
+		if w.isRoot(docURI) || !inline {
+			local := "#" + frag
+			if !w.isRoot(docURI) {
+				local, err = w.bundleRef(abs, docURI, frag, typ)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			out := newObjectLike(node)
+			for _, key := range objectKeys(node) {
+				v, _ := objectGet(node, key)
+				if key == "$ref" {
+					v = local
+				}
+				objectSet(out, key, v)
+			}
+			return out, nil
+		}
+	}
+
+	for _, s := range w.stack {
+		if s == abs {
+			return nil, refError(ErrCircularReference)
+		}
+	}
+
+	target, err := w.lookup(docURI, frag)
+	if err != nil {
+		return nil, refError(errors.Wrap(ErrUnresolvable, err.Error()))
+	}
+
+	w.stack = append(w.stack, abs)
+	resolved, err := w.walk(target, fieldType{typ, single}, w.documentBase(docURI), frag)
+	w.stack = w.stack[:len(w.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	if len(siblings) == 0 {
+		return resolved, nil
+	}
+
+	if !isObject(resolved) {
+		return nil, refError(errors.Wrap(ErrSiblings, "cannot merge keys into a value that is not an object"))
+	}
+	for _, key := range siblings {
+		child, _ := objectGet(node, key)
+		v, err := w.walk(child, childType(typ, key), base, ptr+"/"+jsref.EscapePointerToken(key))
+		if err != nil {
+			return nil, err
+		}
+		objectSet(resolved, key, v)
+	}
+	return resolved, nil
+}
+
+// siblings returns the keys next to "$ref" that should be merged into
+// the referenced object. Keys that are not allowed are reported as an
+// error in strict mode, and ignored otherwise.
+func (w *walker) siblings(node interface{}, typ nodeType) ([]string, error) {
+	var merge []string
+	for _, key := range objectKeys(node) {
+		if key == "$ref" {
+			continue
+		}
+
+		switch {
+		case typ == typePathItem:
+			// Path Items are merged with the referenced Path Item
+		case typ == typeSchema && w.version == "3.1":
+			// Schemas are JSON Schema 2020-12, which allows siblings
+		case (key == "summary" || key == "description") && w.version == "3.1":
+			// Reference Objects may override these in 3.1
+		default:
+			if w.strict {
+				return nil, errors.Wrapf(ErrSiblings, "%q is not allowed next to $ref", key)
+			}
+			continue
+		}
+		merge = append(merge, key)
+	}
+	return merge, nil
+}
+
+// bundleRef registers the target of an external reference as a
+// component, and returns the local reference to it
+func (w *walker) bundleRef(abs, docURI, frag string, typ nodeType) (string, error) {
+	if local, ok := w.bundled[abs]; ok {
+		return local, nil
+	}
+
+	section := componentSections[typ]
+	name := w.componentName(section, docURI, frag)
+	local := "#/components/" + section + "/" + jsref.EscapePointerToken(name)
+	w.bundled[abs] = local
+
+	target, err := w.lookup(docURI, frag)
+	if err != nil {
+		return "", &ReferenceError{Document: docURI, Pointer: frag, Ref: abs, Err: errors.Wrap(ErrUnresolvable, err.Error())}
+	}
+
+	value, err := w.walk(target, fieldType{typ, single}, docURI, frag)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := w.components[section]; !ok {
+		w.sections = append(w.sections, section)
+	}
+	w.components[section] = append(w.components[section], component{name: name, value: value})
+	return local, nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// componentName picks an unused name for a bundled component
+func (w *walker) componentName(section, docURI, frag string) string {
+	var name string
+	if frag != "" {
+		name = frag[strings.LastIndexByte(frag, '/')+1:]
+		name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+	} else {
+		name = path.Base(docURI)
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if name == "" {
+		name = "component"
+	}
+
+	candidate := name
+	for i := 1; w.used[section+"/"+candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	w.used[section+"/"+candidate] = true
+	return candidate
+}
+
+func (w *walker) checkOperationRef(node interface{}, base, ptr string) error {
+	ref, ok := objectString(node, "operationRef")
+	if !ok {
+		return nil
+	}
+
+	abs, err := jsref.ResolveURI(base, ref)
+	if err == nil {
+		docURI, frag := splitRef(abs)
+		_, err = w.lookup(docURI, frag)
+	}
+	if err != nil {
+		return &ReferenceError{Document: w.documentName(base), Pointer: ptr + "/operationRef", Ref: ref, Err: errors.Wrap(ErrUnresolvable, err.Error())}
+	}
+	return nil
+}
+
+// lookup returns the object pointed to by `frag` in the document at
+// `docURI`, without processing any references
+func (w *walker) lookup(docURI, frag string) (interface{}, error) {
+	var doc interface{}
+	if w.isRoot(docURI) {
+		doc = w.root
+	} else if v, ok := w.docs[docURI]; ok {
+		doc = v
+	} else {
+		v, err := w.oa.Load(docURI)
+		if err != nil {
+			return nil, err
+		}
+		w.docs[docURI] = v
+		doc = v
+	}
+	return jsref.EvalPointer(doc, frag)
+}
+
+func (w *walker) isRoot(docURI string) bool {
+	if docURI == "" {
+		return true
+	}
+	base, _ := splitRef(w.base)
+	return docURI == base
+}
+
+// documentBase returns the URI that references in the document at
+// `docURI` are relative to
+func (w *walker) documentBase(docURI string) string {
+	if w.isRoot(docURI) {
+		return w.base
+	}
+	return docURI
+}
+
+// documentName returns the name of the document at `base` as reported
+// in errors, which is empty for the root document
+func (w *walker) documentName(base string) string {
+	docURI, _ := splitRef(base)
+	if w.isRoot(docURI) {
+		return ""
+	}
+	return docURI
+}
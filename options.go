@@ -18,3 +18,88 @@ type identRecursiveResolution struct{}
 func WithRecursiveResolution(b bool) Option {
 	return option.New(identRecursiveResolution{}, b)
 }
+
+type identUseNumber struct{}
+type identOrderedObjects struct{}
+
+// WithUseNumber specifies that numbers in raw JSON documents (see
+// `ResolveJSON`) should be decoded as `json.Number` instead of float64,
+// so that large integers do not lose precision.
+func WithUseNumber(b bool) Option {
+	return option.New(identUseNumber{}, b)
+}
+
+// WithOrderedObjects specifies that objects in raw JSON documents (see
+// `ResolveJSON`) should be decoded as `*OrderedMap`, preserving the
+// order of their keys.
+func WithOrderedObjects(b bool) Option {
+	return option.New(identOrderedObjects{}, b)
+}
+
+type identSiblingPolicy struct{}
+
+// WithSiblingPolicy overrides the Resolver's `SiblingPolicy` for a
+// single call to `Resolve`.
+func WithSiblingPolicy(p SiblingPolicy) Option {
+	return option.New(identSiblingPolicy{}, p)
+}
+
+type identBaseURI struct{}
+type identSourceMap struct{}
+type identLimits struct{}
+type identLazyResolution struct{}
+type identCopyOnWrite struct{}
+type identLockfile struct{}
+
+// WithBaseURI specifies the URI of the document passed to `Resolve`.
+// It is used to identify the document in the locations recorded
+// in a SourceMap, and in the dynamic scope.
+func WithBaseURI(s string) Option {
+	return option.New(identBaseURI{}, s)
+}
+
+// WithSourceMap specifies a SourceMap where the origin of the
+// resolved values is recorded.
+func WithSourceMap(sm *SourceMap) Option {
+	return option.New(identSourceMap{}, sm)
+}
+
+// WithLimits overrides the `Limits` of the Resolver for a single
+// call to `Resolve`
+func WithLimits(l Limits) Option {
+	return option.New(identLimits{}, l)
+}
+
+// WithLazyResolution specifies that `Resolve` should return a `*Node`,
+// whose children are only resolved when they are accessed. This
+// option takes precedence over `WithRecursiveResolution`.
+func WithLazyResolution(b bool) Option {
+	return option.New(identLazyResolution{}, b)
+}
+
+// WithCopyOnWrite specifies that `Set` and `Delete` should leave the
+// documents untouched, and return a modified copy instead. Only the
+// containers on the path to the modified value are copied.
+func WithCopyOnWrite(b bool) Option {
+	return option.New(identCopyOnWrite{}, b)
+}
+
+type lockfileOption struct {
+	lockfile *Lockfile
+	mode     LockMode
+}
+
+// WithLockfile specifies a Lockfile that the external documents loaded
+// through the providers are verified against, or recorded in,
+// depending on `mode`
+func WithLockfile(l *Lockfile, mode LockMode) Option {
+	return option.New(identLockfile{}, lockfileOption{lockfile: l, mode: mode})
+}
+
+type identReferencePolicy struct{}
+
+// WithReferencePolicy overrides the Resolver's `ReferencePolicy` for a
+// single call to `Resolve`. A nil policy allows any reference.
+func WithReferencePolicy(p ReferencePolicy) Option {
+	return option.New(identReferencePolicy{}, p)
+}
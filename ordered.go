@@ -0,0 +1,32 @@
+package jsref
+
+import (
+	"encoding/json"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+)
+
+// OrderedMap is a JSON object that remembers the order in which its
+// keys appeared in the source document. It is understood by `Resolver`
+// wherever a `map[string]interface{}` would be, and when marshaled
+// back to JSON the keys are written in their original order.
+type OrderedMap = jsondoc.OrderedMap
+
+// NewOrderedMap creates a new empty OrderedMap
+func NewOrderedMap() *OrderedMap {
+	return jsondoc.NewOrderedMap()
+}
+
+// DecodeOrdered decodes the next JSON value from `dec`, using
+// OrderedMap for objects instead of `map[string]interface{}`.
+// Numbers are decoded as `json.Number` if `dec.UseNumber()` was
+// called, and as float64 otherwise.
+func DecodeOrdered(dec *json.Decoder) (interface{}, error) {
+	return jsondoc.DecodeOrdered(dec)
+}
+
+// decodeJSON decodes a single JSON value from `dec` according to the
+// given settings
+func decodeJSON(dec *json.Decoder, useNumber, ordered bool) (interface{}, error) {
+	return jsondoc.Decode(dec, useNumber, ordered)
+}
@@ -0,0 +1,110 @@
+package jsref
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lestrrat-go/structinfo"
+	"github.com/pkg/errors"
+)
+
+// jsonGetter is implemented by containers that know how to look up
+// their own children, such as *OrderedMap
+type jsonGetter interface {
+	JSONGet(tok string) (interface{}, error)
+}
+
+// EvalPointer evaluates the JSON pointer `ptr` against `v`, without
+// resolving any references. `ptr` may optionally start with '#'.
+// Both "~0" and "~1" escapes in `ptr` are honored.
+func EvalPointer(v interface{}, ptr string) (interface{}, error) {
+	tokens, err := splitPointer(strings.TrimPrefix(ptr, "#"))
+	if err != nil {
+		return nil, err
+	}
+	return pointerGet(v, tokens)
+}
+
+// EscapePointerToken escapes `tok` so that it can be used as a
+// reference token in a JSON pointer
+func EscapePointerToken(tok string) string {
+	if strings.IndexAny(tok, "~/") < 0 {
+		return tok
+	}
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(tok)
+}
+
+// pointerGet evaluates the unescaped reference tokens against `v`.
+// It replaces github.com/lestrrat-go/jspointer, which does not
+// unescape "~1", so that pointers into OpenAPI "paths" such as
+// "#/paths/~1users" could not be evaluated, and which does not know
+// how to look up the children of an *OrderedMap.
+func pointerGet(v interface{}, tokens []string) (interface{}, error) {
+	node := v
+	for i, tok := range tokens {
+		x, err := pointerChild(node, tok)
+		if err != nil {
+			return nil, errors.Wrapf(err, "match to JSON pointer not found: /%s", strings.Join(tokens[:i+1], "/"))
+		}
+		node = x
+	}
+	return node, nil
+}
+
+// pointerChild returns the child of `node` denoted by `tok`
+func pointerChild(node interface{}, tok string) (interface{}, error) {
+	if getter, ok := node.(jsonGetter); ok {
+		return getter.JSONGet(tok)
+	}
+
+	rv := reflect.ValueOf(node)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		fn := structinfo.StructFieldFromJSONName(rv, tok)
+		if fn == "" {
+			return nil, errors.Errorf("field %q not found", tok)
+		}
+		return rv.FieldByName(fn).Interface(), nil
+	case reflect.Map:
+		kv, err := mapKey(rv.Type().Key(), tok)
+		if err != nil {
+			return nil, err
+		}
+		x := rv.MapIndex(kv)
+		if !x.IsValid() {
+			return nil, errors.Errorf("key %q not found", tok)
+		}
+		return x.Interface(), nil
+	case reflect.Slice, reflect.Array:
+		idx, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, errors.Errorf("invalid array index %q", tok)
+		}
+		if idx < 0 || idx >= rv.Len() {
+			return nil, errors.Errorf("array index %d out of bounds", idx)
+		}
+		return rv.Index(idx).Interface(), nil
+	}
+	return nil, errors.Errorf("cannot look up %q in a %s", tok, rv.Kind())
+}
+
+// mapKey converts a reference token into a value that can be used
+// as a key for a map whose keys are of type `t`
+func mapKey(t reflect.Type, tok string) (reflect.Value, error) {
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(tok).Convert(t), nil
+	}
+
+	kv := reflect.New(t)
+	if err := json.Unmarshal([]byte(tok), kv.Interface()); err != nil {
+		return zeroval, errors.Errorf("unsupported conversion of %q to %s", tok, t)
+	}
+	return kv.Elem(), nil
+}
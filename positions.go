@@ -0,0 +1,95 @@
+package jsref
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+)
+
+// Position is a location within the source of a JSON document.
+// Line and Column start at 1, and Column counts characters, not
+// bytes. Offset is the byte offset from the start of the document.
+type Position = jsondoc.Position
+
+// PositionIndex maps the JSON pointers of the values in a document
+// to their position in the source of the document.
+type PositionIndex = jsondoc.PositionIndex
+
+// PositionProvider is implemented by Providers that can report the
+// positions of the values in the documents they return. The resolver
+// uses it to annotate errors and `SourceMap` entries with positions.
+type PositionProvider interface {
+	Positions(*url.URL) (*PositionIndex, bool)
+}
+
+// IndexPositions scans the JSON document in `src`, and records the
+// position where each of its values start.
+func IndexPositions(src []byte) (*PositionIndex, error) {
+	return jsondoc.IndexPositions(src)
+}
+
+// positionCache holds the position indexes of the documents visited
+// during a single call to `Resolve`. Indexes are only built when they
+// are needed.
+type positionCache struct {
+	mu      sync.Mutex
+	r       *Resolver
+	rootURI string
+	root    json.RawMessage
+	indexes map[string]*PositionIndex
+}
+
+func newPositionCache(r *Resolver, rootURI string, root interface{}) *positionCache {
+	raw, _ := root.(json.RawMessage)
+	return &positionCache{
+		r:       r,
+		rootURI: rootURI,
+		root:    raw,
+		indexes: make(map[string]*PositionIndex),
+	}
+}
+
+// index returns the position index of the document at `uri`, or nil
+// if positions are not available for it
+func (pc *positionCache) index(uri string) *PositionIndex {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if idx, ok := pc.indexes[uri]; ok {
+		return idx
+	}
+
+	var idx *PositionIndex
+	if uri == pc.rootURI && pc.root != nil {
+		idx, _ = IndexPositions(pc.root)
+	} else if u, err := url.Parse(uri); err == nil && uri != "" {
+		for _, p := range pc.r.providers {
+			pp, ok := p.(PositionProvider)
+			if !ok {
+				continue
+			}
+			if x, ok := pp.Positions(u); ok {
+				idx = x
+				break
+			}
+		}
+	}
+	pc.indexes[uri] = idx
+	return idx
+}
+
+// position returns the position of the value described by `loc`. If
+// `keyword` is not empty and the value is an object, the position of
+// the value of that keyword is preferred.
+func (pc *positionCache) position(loc Location, keyword string) Position {
+	idx := pc.index(loc.Document)
+	if keyword != "" {
+		if pos, ok := idx.Lookup(loc.Pointer + "/" + EscapePointerToken(keyword)); ok {
+			return pos
+		}
+	}
+	pos, _ := idx.Lookup(loc.Pointer)
+	return pos
+}
@@ -0,0 +1,305 @@
+package jsref
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Location describes where a value returned by `Resolve` originated.
+type Location struct {
+	// Document is the URI of the document the value was found in.
+	// For the value passed to `Resolve` this is the URI given with
+	// `WithBaseURI`, or the empty string.
+	Document string
+	// Pointer is the JSON pointer to the value within Document
+	Pointer string
+	// Refs is the chain of references that were followed to reach
+	// the value, outermost first
+	Refs []string
+	// Position is the position of the value within Document. It is
+	// only known for documents that were loaded with their positions,
+	// see `PositionProvider`
+	Position Position
+}
+
+// String returns the location in the form of a URI reference
+func (l Location) String() string {
+	return l.Document + "#" + l.Pointer
+}
+
+// SourceMap records the origin of the values returned by `Resolve`.
+// Pass it to `Resolve` using the `WithSourceMap` option.
+//
+// Locations are recorded for the result itself, and for every
+// reference that was replaced during recursive resolution. Values
+// that were not replaced share the location of their closest
+// recorded ancestor, which `Lookup` takes into account.
+type SourceMap struct {
+	mu      sync.RWMutex
+	entries map[string]Location
+	index   func(string) *PositionIndex
+}
+
+// NewSourceMap creates a new empty SourceMap
+func NewSourceMap() *SourceMap {
+	return &SourceMap{
+		entries: make(map[string]Location),
+	}
+}
+
+// Lookup returns the location of the value at the JSON pointer `ptr`
+// within the result of `Resolve`.
+func (sm *SourceMap) Lookup(ptr string) (Location, bool) {
+	loc, ok := sm.lookup(strings.TrimPrefix(ptr, "#"))
+	if !ok {
+		return loc, false
+	}
+
+	sm.mu.RLock()
+	index := sm.index
+	sm.mu.RUnlock()
+	if index != nil {
+		if idx := index(loc.Document); idx != nil {
+			loc.Position, _ = idx.Lookup(loc.Pointer)
+		}
+	}
+	return loc, true
+}
+
+// lookup works like Lookup, without filling in the position
+func (sm *SourceMap) lookup(ptr string) (Location, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	suffix := ""
+	for {
+		if loc, ok := sm.entries[ptr]; ok {
+			loc.Pointer += suffix
+			return loc, true
+		}
+		i := strings.LastIndexByte(ptr, '/')
+		if i < 0 {
+			return Location{}, false
+		}
+		suffix = ptr[i:] + suffix
+		ptr = ptr[:i]
+	}
+}
+
+// Pointers returns the JSON pointers within the result of `Resolve`
+// for which a location was recorded, in lexical order.
+func (sm *SourceMap) Pointers() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ptrs := make([]string, 0, len(sm.entries))
+	for ptr := range sm.entries {
+		ptrs = append(ptrs, ptr)
+	}
+	sort.Strings(ptrs)
+	return ptrs
+}
+
+// Reset removes all recorded locations
+func (sm *SourceMap) Reset() {
+	sm.reset(nil)
+}
+
+func (sm *SourceMap) reset(index func(string) *PositionIndex) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.entries = make(map[string]Location)
+	sm.index = index
+}
+
+func (sm *SourceMap) set(ptr string, loc Location) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.entries[ptr] = loc
+}
+
+// trailEntry is the location of a value that replaced a reference
+// found at depth `depth` of the current path
+type trailEntry struct {
+	depth int
+	loc   Location
+}
+
+// record stores the location of the value that was most recently
+// resolved as the origin of the value at the current path
+func (ctx *resolveCtx) record() {
+	if ctx.located == nil {
+		return
+	}
+	ctx.trail = append(ctx.trail, trailEntry{depth: len(ctx.path), loc: *ctx.located})
+	if ctx.sourceMap != nil {
+		ctx.sourceMap.set(ctx.pathString(), *ctx.located)
+	}
+}
+
+// locatedHere stands for the location of the value at the current
+// path, see `here`
+var locatedHere = &Location{}
+
+// here returns the location of the value at the current path, based
+// on the closest value along the path that replaced a reference. It
+// is only computed when it is needed, such as to report an error.
+func (ctx *resolveCtx) here() *Location {
+	if len(ctx.trail) == 0 {
+		return nil
+	}
+
+	e := ctx.trail[len(ctx.trail)-1]
+	loc := e.loc
+	var b strings.Builder
+	b.WriteString(loc.Pointer)
+	for _, tok := range ctx.path[e.depth:] {
+		b.WriteByte('/')
+		b.WriteString(EscapePointerToken(tok))
+	}
+	loc.Pointer = b.String()
+	return &loc
+}
+
+// expandRefAt expands the references in `v`, which is found at the
+// current path, and records where the expanded value came from
+func expandRefAt(ctx *resolveCtx, r *Resolver, v interface{}) (interface{}, error) {
+	ctx.located = locatedHere
+	newv, err := expandRefRecursive(ctx, r, v)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.located == locatedHere {
+		ctx.located = nil
+		return newv, nil
+	}
+	ctx.record()
+	return newv, nil
+}
+
+func (ctx *resolveCtx) pushPath(tok string) {
+	ctx.path = append(ctx.path, tok)
+}
+
+func (ctx *resolveCtx) popPath() {
+	ctx.path = ctx.path[:len(ctx.path)-1]
+	for len(ctx.trail) > 0 && ctx.trail[len(ctx.trail)-1].depth > len(ctx.path) {
+		ctx.trail = ctx.trail[:len(ctx.trail)-1]
+	}
+}
+
+// mapKeyToken returns the reference token for a map key
+func mapKeyToken(key reflect.Value) string {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10)
+	}
+	return ""
+}
+
+// structFieldToken returns the reference token for the i-th field
+// of the struct type `t`
+func structFieldToken(t reflect.Type, i int) string {
+	f := t.Field(i)
+	tag := f.Tag.Get("json")
+	if j := strings.IndexByte(tag, ','); j >= 0 {
+		tag = tag[:j]
+	}
+	if tag == "" || tag == "-" {
+		return f.Name
+	}
+	return tag
+}
+
+// visit is called when the traversal enters a container. Containers
+// may be shared between several places in the result, in which case
+// the references within them have only been replaced the first time
+// around: the locations recorded back then are copied to the current
+// path.
+func (ctx *resolveCtx) visit(rv reflect.Value) {
+	if ctx.sourceMap == nil {
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Ptr, reflect.Slice:
+	default:
+		return
+	}
+	id := rv.Pointer()
+	if id == 0 {
+		return
+	}
+
+	path := ctx.pathString()
+	prev, ok := ctx.visited[id]
+	if !ok {
+		ctx.visited[id] = path
+		return
+	}
+	if prev != path {
+		ctx.sourceMap.copyTree(prev, path)
+	}
+}
+
+func (ctx *resolveCtx) pathString() string {
+	var b strings.Builder
+	for _, tok := range ctx.path {
+		b.WriteByte('/')
+		b.WriteString(EscapePointerToken(tok))
+	}
+	return b.String()
+}
+
+// copyTree copies the locations recorded below `from` to below `to`,
+// unless a location is already recorded there
+func (sm *SourceMap) copyTree(from, to string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	prefix := from + "/"
+	copied := make(map[string]Location)
+	for ptr, loc := range sm.entries {
+		if !strings.HasPrefix(ptr, prefix) {
+			continue
+		}
+		dst := to + ptr[len(from):]
+		if _, ok := sm.entries[dst]; !ok {
+			copied[dst] = loc
+		}
+	}
+	for ptr, loc := range copied {
+		sm.entries[ptr] = loc
+	}
+}
+
+// origin returns the location `loc` refers to. When recursively
+// resolving, references in the document passed to `Resolve` are
+// replaced as they are traversed, so a location within that document
+// may hold a value that originates from somewhere else.
+func (ctx *resolveCtx) origin(loc Location) *Location {
+	if !ctx.inRoot || ctx.sourceMap == nil {
+		return &loc
+	}
+
+	if !strings.HasPrefix(loc.Pointer, ctx.resultPtr) {
+		return &loc
+	}
+	rel := loc.Pointer[len(ctx.resultPtr):]
+	if rel != "" && rel[0] != '/' {
+		return &loc
+	}
+
+	found, ok := ctx.sourceMap.lookup(rel)
+	if !ok {
+		return &loc
+	}
+	return &found
+}
@@ -0,0 +1,376 @@
+package provider
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// archiveMember is a file within an archive
+type archiveMember interface {
+	Open() (io.ReadCloser, error)
+}
+
+// maxDecompressedSize is the maximum amount of data decompressed from
+// a member of an archive, or from the whole of a compressed tar
+// archive, so that a small archive cannot expand without bounds
+const maxDecompressedSize = 1 << 30
+
+// tarMember is a file within a tar archive. Tar archives cannot be
+// accessed randomly, so the archive is read again up to the member
+// each time it is opened: uncompressed archives are skipped through
+// without reading the other members, while compressed ones have to
+// be decompressed.
+type tarMember struct {
+	src   io.ReaderAt
+	size  int64 // of the archive
+	gzip  bool
+	index int // of the header of the member in the archive
+}
+
+func (m *tarMember) Open() (io.ReadCloser, error) {
+	tr, closer, err := openTar(m.src, m.size, m.gzip)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		if _, err := tr.Next(); err != nil {
+			closer.Close()
+			return nil, errors.Wrap(err, "failed to read tar archive")
+		}
+		if i == m.index {
+			return &readCloser{Reader: tr, Closer: closer}, nil
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// capReader fails once more than `max` bytes are read from `r`
+type capReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func newCapReader(r io.Reader, max int64) *capReader {
+	// Read one more byte than allowed, to tell data of the maximum
+	// size from larger data
+	return &capReader{r: io.LimitReader(r, max+1), max: max}
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return 0, &jsondoc.LimitError{Limit: "bytes", Max: c.max}
+	}
+	return n, err
+}
+
+// OpenArchive opens the archive at `filename`, and creates a new
+// Provider that serves its members. See `NewArchive` for details.
+// The archive must be closed with `Close` once it is not used anymore.
+func OpenArchive(filename string, options ...Option) (*Archive, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute absolute path of archive")
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to stat archive")
+	}
+
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	ap, err := NewArchive(f, fi.Size(), u.String(), options...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ap.closer = f
+	return ap, nil
+}
+
+// NewArchive creates a new Provider that serves the JSON documents
+// stored in a zip, tar or gzip compressed tar archive, read from `src`.
+// The format is detected from the content of the archive.
+//
+// Members are served like `FS` serves files, with "file" URIs whose
+// path is the path of the member in the archive, such as
+// "file:///schemas/pet.json". They are also served with "jar" URIs,
+// made of `name`, the URI of the archive, followed by "!" and the
+// path of the member, such as
+//
+//	jar:https://example.com/schemas.zip!/schemas/pet.json
+//
+// Members whose name ends with ".gz" are decompressed, and a document
+// such as "pet.json" is looked up as "pet.json.gz" if the archive does
+// not contain it. Members are only read when they are requested. At
+// most 1 GiB is decompressed from a member, or from a compressed tar
+// archive; `WithMaxBytes` sets a lower limit on documents.
+func NewArchive(src io.ReaderAt, size int64, name string, options ...Option) (*Archive, error) {
+	members, err := readArchive(src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	ap := &Archive{
+		mp:      NewMap(),
+		name:    name,
+		members: members,
+	}
+	ap.decode.apply(options)
+	return ap, nil
+}
+
+// Get fetches the document specified by the `key` argument from the
+// archive. Note that once a document is read, it WILL be cached for
+// the duration of this object, unless you call `Reset`
+func (ap *Archive) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Archive.Get(%s)", key.String()).BindError(&err)
+		defer g.End()
+	}
+
+	name, err := ap.memberName(key)
+	if err != nil {
+		return nil, err
+	}
+
+	mpkey := &url.URL{Path: name}
+	if x, err := ap.mp.Get(mpkey); err == nil {
+		return x, nil
+	}
+
+	m, ok := ap.members[name]
+	if !ok {
+		return nil, errors.Errorf("%s is not in archive %s", name, ap.name)
+	}
+
+	rc, err := m.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s in archive", name)
+	}
+	defer rc.Close()
+
+	var src io.Reader = rc
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decompress %s", name)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	doc, err := ap.decode.decode(newCapReader(src, maxDecompressedSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSON from archive")
+	}
+
+	if err := ap.mp.store(name, doc); err != nil {
+		return nil, errors.Wrapf(err, `failed to set value to %q`, name)
+	}
+
+	return doc.value, nil
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if it was loaded with `WithPositions`
+func (ap *Archive) Positions(key *url.URL) (*PositionIndex, bool) {
+	name, err := ap.memberName(key)
+	if err != nil {
+		return nil, false
+	}
+	return ap.mp.Positions(&url.URL{Path: name})
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if it was loaded. The size of compressed
+// documents is their size once decompressed.
+func (ap *Archive) Size(key *url.URL) (int64, bool) {
+	name, err := ap.memberName(key)
+	if err != nil {
+		return 0, false
+	}
+	return ap.mp.Size(&url.URL{Path: name})
+}
+
+// Names returns the paths of the members of the archive, sorted
+func (ap *Archive) Names() []string {
+	names := make([]string, 0, len(ap.members))
+	for name := range ap.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset resets the in memory cache of JSON documents
+func (ap *Archive) Reset() error {
+	return ap.mp.Reset()
+}
+
+// Close closes the archive file opened by `OpenArchive`. It does
+// nothing for archives created with `NewArchive`.
+func (ap *Archive) Close() error {
+	if ap.closer == nil {
+		return nil
+	}
+	return ap.closer.Close()
+}
+
+// memberName returns the path of the member of the archive specified
+// by `key`
+func (ap *Archive) memberName(key *url.URL) (string, error) {
+	var p string
+	switch strings.ToLower(key.Scheme) {
+	case "file":
+		p = key.Path
+	case "jar":
+		// The archive URI is opaque, as it has no leading slash
+		spec := key.Opaque
+		if spec == "" {
+			return "", errors.New("invalid jar URI '" + key.String() + "'")
+		}
+		i := strings.Index(spec, "!/")
+		if i < 0 {
+			return "", errors.New("jar URI '" + key.String() + "' does not contain '!/'")
+		}
+		if !sameArchive(spec[:i], ap.name) {
+			return "", errors.Errorf("jar URI '%s' does not refer to archive %s", key, ap.name)
+		}
+		p, _ = url.PathUnescape(spec[i+1:])
+	default:
+		return "", errors.New("unsupported scheme '" + key.Scheme + "'")
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if _, ok := ap.members[name]; !ok {
+		if _, ok := ap.members[name+".gz"]; ok {
+			return name + ".gz", nil
+		}
+	}
+	return name, nil
+}
+
+// sameArchive returns true if the URIs `a` and `b` are the same,
+// ignoring the case of their schemes
+func sameArchive(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	ua.Scheme = strings.ToLower(ua.Scheme)
+	ub.Scheme = strings.ToLower(ub.Scheme)
+	return ua.String() == ub.String()
+}
+
+// readArchive lists the regular files in the archive read from `src`
+func readArchive(src io.ReaderAt, size int64) (map[string]archiveMember, error) {
+	var magic [4]byte
+	if _, err := src.ReadAt(magic[:], 0); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to read archive")
+	}
+
+	members := make(map[string]archiveMember)
+	switch {
+	case bytes.Equal(magic[:], []byte("PK\x03\x04")), bytes.Equal(magic[:], []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(src, size)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read zip archive")
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			members[cleanMemberName(f.Name)] = f
+		}
+		return members, nil
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		if err := readTar(src, size, true, members); err != nil {
+			return nil, err
+		}
+		return members, nil
+	}
+
+	var ustar [5]byte
+	if _, err := src.ReadAt(ustar[:], 257); err == nil && string(ustar[:]) == "ustar" {
+		if err := readTar(src, size, false, members); err != nil {
+			return nil, err
+		}
+		return members, nil
+	}
+	return nil, errors.New("unsupported archive format")
+}
+
+// openTar returns a reader for the tar archive read from `src`, which
+// is compressed if `gz` is true
+func openTar(src io.ReaderAt, size int64, gz bool) (*tar.Reader, io.Closer, error) {
+	r := io.NewSectionReader(src, 0, size)
+	if !gz {
+		return tar.NewReader(r), ioutil.NopCloser(nil), nil
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decompress archive")
+	}
+	return tar.NewReader(newCapReader(zr, maxDecompressedSize)), zr, nil
+}
+
+// readTar lists the regular files in a tar archive, without reading
+// their content
+func readTar(src io.ReaderAt, size int64, gz bool, members map[string]archiveMember) error {
+	tr, closer, err := openTar(src, size, gz)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar archive")
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		members[cleanMemberName(hdr.Name)] = &tarMember{src: src, size: size, gzip: gz, index: i}
+	}
+}
+
+func cleanMemberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
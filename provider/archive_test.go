@@ -0,0 +1,143 @@
+package provider_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return buf.Bytes()
+	}
+	files := []struct {
+		Name    string
+		Content []byte
+	}{
+		{Name: "schemas/pet.json", Content: []byte(`{"name": "pet", "tag": {"$ref": "jar:https://example.com/schemas.zip!/schemas/tag.json#/name"}}`)},
+		{Name: "schemas/tag.json.gz", Content: gzipped(`{"name": "tag"}`)},
+	}
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for _, f := range files {
+		w, err := zw.Create(f.Name)
+		if !assert.NoError(t, err, "zip.Create should succeed") {
+			return
+		}
+		w.Write(f.Content)
+	}
+	if !assert.NoError(t, zw.Close(), "zip.Close should succeed") {
+		return
+	}
+
+	ap, err := provider.NewArchive(bytes.NewReader(zbuf.Bytes()), int64(zbuf.Len()), "https://example.com/schemas.zip")
+	if !assert.NoError(t, err, "NewArchive should succeed") {
+		return
+	}
+	if !assert.Equal(t, []string{"schemas/pet.json", "schemas/tag.json.gz"}, ap.Names(), "Names should list the members") {
+		return
+	}
+
+	res := jsref.New()
+	res.AddProvider(ap)
+	for ref, expected := range map[string]interface{}{
+		"file:///schemas/pet.json#/name":                                   "pet",
+		"jar:https://example.com/schemas.zip!/schemas/pet.json#/name":      "pet",
+		"JAR:HTTPS://example.com/schemas.zip!/./schemas/pet.json#/tag":     "tag",
+		"file:///schemas/tag.json#/name":                                   "tag",
+		"jar:https://example.com/schemas.zip!/schemas/tag.json.gz#/name":   "tag",
+		"jar:https://example.com/schemas.zip!/schemas/../schemas/pet.json": map[string]interface{}{"name": "pet", "tag": "tag"},
+	} {
+		v, err := res.Resolve(map[string]interface{}{"$ref": ref}, "", jsref.WithRecursiveResolution(true))
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", ref) {
+			return
+		}
+		if !assert.Equal(t, expected, v, "Resolve(%s) should return the member", ref) {
+			return
+		}
+	}
+	for _, ref := range []string{
+		"jar:https://example.com/other.zip!/schemas/pet.json#/name",
+		"jar:https://example.com/schemas.zip#/name",
+		"file:///schemas/missing.json#/name",
+		"http://example.com/schemas/pet.json#/name",
+	} {
+		_, err := res.Resolve(map[string]interface{}{"$ref": ref}, "")
+		if !assert.Error(t, err, "Resolve(%s) should fail", ref) {
+			return
+		}
+	}
+
+	var tbuf bytes.Buffer
+	gz := gzip.NewWriter(&tbuf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: "./" + f.Name, Mode: 0644, Size: int64(len(f.Content)), Typeflag: tar.TypeReg})
+		tw.Write(f.Content)
+	}
+	if !assert.NoError(t, tw.Close(), "tar.Close should succeed") {
+		return
+	}
+	if !assert.NoError(t, gz.Close(), "gzip.Close should succeed") {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "jsref-archive")
+	if !assert.NoError(t, err, "TempDir should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "schemas.tar.gz")
+	if !assert.NoError(t, ioutil.WriteFile(filename, tbuf.Bytes(), 0644), "WriteFile should succeed") {
+		return
+	}
+
+	ap, err = provider.OpenArchive(filename)
+	if !assert.NoError(t, err, "OpenArchive should succeed") {
+		return
+	}
+	defer ap.Close()
+
+	res = jsref.New()
+	res.AddProvider(ap)
+	v, err := res.Resolve(map[string]interface{}{"$ref": "jar:file://" + filepath.ToSlash(filename) + "!/schemas/tag.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, "tag", v, "Resolve should return the member of the tar archive") {
+		return
+	}
+
+	// Compressed members are decompressed up to the limit
+	limited, err := provider.NewArchive(bytes.NewReader(tbuf.Bytes()), int64(tbuf.Len()), "file:///schemas.tar.gz", provider.WithMaxBytes(8))
+	if !assert.NoError(t, err, "NewArchive should succeed") {
+		return
+	}
+	u, _ := url.Parse("file:///schemas/tag.json")
+	_, err = limited.Get(u)
+	if !assert.True(t, errors.Is(err, jsref.ErrLimitExceeded), "Get should fail on members larger than WithMaxBytes once decompressed, got %v", err) {
+		return
+	}
+
+	_, err = provider.NewArchive(strings.NewReader("not an archive"), 14, "file:///x")
+	if !assert.Error(t, err, "NewArchive should fail on unknown formats") {
+		return
+	}
+}
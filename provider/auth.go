@@ -0,0 +1,243 @@
+package provider
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Credentials adds authentication to the requests made by the HTTP
+// provider. Credentials are registered per host with `WithCredentials`,
+// and are only applied to requests made to that host.
+type Credentials interface {
+	Apply(*http.Request) error
+}
+
+// CredentialsFunc is a function that implements Credentials. It can
+// be used to fetch or refresh tokens as requests are made.
+type CredentialsFunc func(*http.Request) error
+
+// Apply calls f(req)
+func (f CredentialsFunc) Apply(req *http.Request) error {
+	return f(req)
+}
+
+type bearerToken string
+
+func (t bearerToken) Apply(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// BearerToken returns Credentials that send `token` in the
+// Authorization header
+func BearerToken(token string) Credentials {
+	return bearerToken(token)
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (b basicAuth) Apply(req *http.Request) error {
+	req.SetBasicAuth(b.username, b.password)
+	return nil
+}
+
+// BasicAuth returns Credentials that use HTTP basic authentication
+func BasicAuth(username, password string) Credentials {
+	return basicAuth{username: username, password: password}
+}
+
+// authTransport adds headers and credentials to each request, based
+// on the host that the request is made to. Since they are added to
+// each request as it is sent, rather than to the request made by the
+// provider, they are never carried over to the requests made when
+// following a redirect to another host. Requests that follow a
+// redirect from HTTPS to HTTP only get the headers that are not
+// specific to a host, so that credentials are never sent in clear.
+type authTransport struct {
+	base        http.RoundTripper
+	credentials map[string]Credentials
+	netrc       *netrc
+	headers     http.Header
+	hostHeaders map[string]http.Header
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+
+	for name, values := range t.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if downgraded(req) {
+		return t.base.RoundTrip(req)
+	}
+	if h, ok := t.hostHeaders[matchHost(req.URL, t.hostHeaders)]; ok {
+		for name, values := range h {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+
+	if c, ok := t.credentials[matchHost(req.URL, t.credentials)]; ok {
+		if err := c.Apply(req); err != nil {
+			return nil, errors.Wrapf(err, "failed to apply credentials for %s", req.URL.Host)
+		}
+	} else if t.netrc != nil {
+		if err := t.netrc.Apply(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// downgraded returns true if `req` follows a redirect from an HTTPS
+// URL to an HTTP URL
+func downgraded(req *http.Request) bool {
+	if !strings.EqualFold(req.URL.Scheme, "http") {
+		return false
+	}
+	for res := req.Response; res != nil && res.Request != nil; res = res.Request.Response {
+		if strings.EqualFold(res.Request.URL.Scheme, "https") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost returns the key of `m` that matches the host of `u`.
+// Keys with a port only match that port, keys without one match any.
+func matchHost[T any](u *url.URL, m map[string]T) string {
+	host := strings.ToLower(u.Host)
+	if _, ok := m[host]; ok {
+		return host
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// netrc provides credentials from a netrc file, as used by curl and
+// ftp. The file is read the first time credentials are needed.
+type netrc struct {
+	path string
+
+	once     sync.Once
+	err      error
+	machines map[string]basicAuth
+	fallback *basicAuth // the "default" entry
+}
+
+func (n *netrc) Apply(req *http.Request) error {
+	n.once.Do(n.load)
+	if n.err != nil {
+		return n.err
+	}
+
+	if c, ok := n.machines[strings.ToLower(req.URL.Hostname())]; ok {
+		return c.Apply(req)
+	}
+	if n.fallback != nil {
+		return n.fallback.Apply(req)
+	}
+	return nil
+}
+
+func (n *netrc) load() {
+	path := n.path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			n.err = errors.Wrap(err, "failed to locate netrc file")
+			return
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		n.err = errors.Wrap(err, "failed to open netrc file")
+		return
+	}
+	defer f.Close()
+
+	n.machines = make(map[string]basicAuth)
+	var current *basicAuth
+	var machine string
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if machine == "" {
+			n.fallback = current
+		} else if _, ok := n.machines[machine]; !ok {
+			// The first entry for a machine wins
+			n.machines[machine] = *current
+		}
+		current = nil
+	}
+
+	// Tokens are separated by white space, including new lines
+	scanner := bufio.NewScanner(f)
+	var pending string // the keyword waiting for its value
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// Macro definitions end with an empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		for _, tok := range strings.Fields(line) {
+			switch pending {
+			case "machine":
+				machine = strings.ToLower(tok)
+			case "login":
+				if current != nil {
+					current.username = tok
+				}
+			case "password":
+				if current != nil {
+					current.password = tok
+				}
+			}
+			if pending != "" {
+				pending = ""
+				continue
+			}
+
+			switch tok {
+			case "machine":
+				flush()
+				current = &basicAuth{}
+				pending = tok
+			case "default":
+				flush()
+				machine = ""
+				current = &basicAuth{}
+			case "login", "password", "account":
+				pending = tok
+			case "macdef":
+				flush()
+				inMacro = true
+			}
+			if inMacro {
+				break
+			}
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		n.err = errors.Wrap(err, "failed to read netrc file")
+	}
+}
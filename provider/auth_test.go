@@ -0,0 +1,159 @@
+package provider_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPAuthentication(t *testing.T) {
+	var forwarded []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/doc.json":
+			forwarded = append(forwarded, r.Header.Get("Authorization"))
+			w.Write([]byte(`{"name": "other"}`))
+		case "/netrc.json":
+			if u, p, ok := r.BasicAuth(); !ok || u != "alice" || p != "s3cret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"name": "netrc"}`))
+		}
+	}))
+	defer other.Close()
+	// Make sure that the two servers are seen as different hosts
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Accept") != "application/schema+json" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/doc.json":
+			w.Write([]byte(`{"name": "origin"}`))
+		case "/redirect.json":
+			http.Redirect(w, r, otherURL+"/doc.json", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+	originURL, _ := url.Parse(origin.URL)
+
+	res := jsref.New()
+	res.AddProvider(provider.NewHTTP(
+		provider.WithCredentials(originURL.Host, provider.BearerToken("token")),
+		provider.WithHeader("Accept", "application/schema+json"),
+	))
+	for ref, expected := range map[string]string{
+		origin.URL + "/doc.json#/name":      "origin",
+		origin.URL + "/redirect.json#/name": "other",
+	} {
+		v, err := res.Resolve(map[string]interface{}{"$ref": ref}, "")
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", ref) {
+			return
+		}
+		if !assert.Equal(t, expected, v) {
+			return
+		}
+	}
+	if !assert.Equal(t, []string{""}, forwarded, "credentials should not be forwarded to another host") {
+		return
+	}
+
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if !assert.NoError(t, ioutil.WriteFile(netrc, []byte("machine example.com login bob password x\n\nmachine localhost\n  login alice\n  password s3cret\n"), 0600), "WriteFile should succeed") {
+		return
+	}
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithNetrc(netrc)))
+	v, err := res.Resolve(map[string]interface{}{"$ref": otherURL + "/netrc.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve with netrc credentials should succeed") {
+		return
+	}
+	if !assert.Equal(t, "netrc", v) {
+		return
+	}
+
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(
+		provider.WithCredentials(originURL.Hostname(), provider.CredentialsFunc(func(*http.Request) error {
+			return errors.New("token expired")
+		})),
+	))
+	var missed error
+	res.AddHook(jsref.HookFunc(func(ev *jsref.Event) {
+		if ev.Kind == jsref.EventProviderMiss {
+			missed = ev.Err
+		}
+	}))
+	_, err = res.Resolve(map[string]interface{}{"$ref": origin.URL + "/doc.json#/name"}, "")
+	if !assert.Error(t, err, "Resolve should fail when credentials cannot be applied") {
+		return
+	}
+	if !assert.Error(t, missed, "provider should report an error") {
+		return
+	}
+	if !assert.Contains(t, missed.Error(), "token expired") {
+		return
+	}
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "secure"}`))
+	}))
+	defer secure.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(secure.Certificate())
+
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithTLSConfig(&tls.Config{RootCAs: pool})))
+	v, err = res.Resolve(map[string]interface{}{"$ref": secure.URL + "/doc.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve over TLS should succeed") {
+		return
+	}
+	if !assert.Equal(t, "secure", v) {
+		return
+	}
+
+	// Credentials are not sent when redirected from HTTPS to HTTP on
+	// the same host
+	forwarded = nil
+	downgrade := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, other.URL+"/doc.json", http.StatusFound)
+	}))
+	defer downgrade.Close()
+	pool = x509.NewCertPool()
+	pool.AddCert(downgrade.Certificate())
+	downgradeURL, _ := url.Parse(downgrade.URL)
+
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(
+		provider.WithTLSConfig(&tls.Config{RootCAs: pool}),
+		provider.WithCredentials(downgradeURL.Hostname(), provider.BearerToken("token")),
+	))
+	v, err = res.Resolve(map[string]interface{}{"$ref": downgrade.URL + "/redirect.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve through a redirect to HTTP should succeed") {
+		return
+	}
+	if !assert.Equal(t, "other", v) {
+		return
+	}
+	if !assert.Equal(t, []string{""}, forwarded, "credentials should not be sent after a redirect from HTTPS to HTTP") {
+		return
+	}
+}
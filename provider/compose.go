@@ -0,0 +1,350 @@
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// Layer is a Provider within a Chain. The name identifies the layer
+// in errors, and when reporting which layer served a document.
+type Layer struct {
+	Name     string
+	Provider Provider
+}
+
+// LayerError is the error returned by a layer of a Chain
+type LayerError struct {
+	Layer string
+	Err   error
+}
+
+func (e *LayerError) Error() string {
+	return e.Layer + ": " + e.Err.Error()
+}
+
+func (e *LayerError) Unwrap() error {
+	return e.Err
+}
+
+// ChainError is returned by a Chain when none of its layers could
+// provide a document. It holds the error returned by each layer.
+type ChainError struct {
+	URL    string
+	Errors []*LayerError
+}
+
+func (e *ChainError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("%s was not found: no layers", e.URL)
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s was not found in any layer: %s", e.URL, strings.Join(msgs, "; "))
+}
+
+// NewChain creates a new Provider that looks for documents in each
+// of the `layers` in turn, and returns the first one found, such as
+// a local override directory, then a vendored copy, then the network.
+// Layers without a name are named after their position, starting
+// from "layer 0".
+//
+// Unlike the providers registered in a Resolver, the errors of all
+// the layers are reported when a document cannot be found. A layer
+// that denies a request by policy stops the search.
+func NewChain(layers ...Layer) *Chain {
+	c := &Chain{
+		layers: make([]Layer, len(layers)),
+		served: make(map[string]int),
+	}
+	for i, l := range layers {
+		if l.Name == "" {
+			l.Name = fmt.Sprintf("layer %d", i)
+		}
+		c.layers[i] = l
+	}
+	return c
+}
+
+// Get fetches the document specified by the `key` argument from the
+// first layer that provides it
+func (c *Chain) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Chain.Get(%s)", key).BindError(&err)
+		defer g.End()
+	}
+
+	var errs []*LayerError
+	for i, l := range c.layers {
+		v, err := l.Provider.Get(key)
+		if err == nil {
+			c.lock.Lock()
+			c.served[key.String()] = i
+			c.lock.Unlock()
+			return v, nil
+		}
+
+		lerr := &LayerError{Layer: l.Name, Err: err}
+		if errors.Is(err, jsondoc.ErrPolicyViolation) {
+			return nil, lerr
+		}
+		errs = append(errs, lerr)
+	}
+	return nil, &ChainError{URL: key.String(), Errors: errs}
+}
+
+// ServedBy returns the name of the layer that served the document
+// specified by the `key` argument, if it was loaded
+func (c *Chain) ServedBy(key *url.URL) (string, bool) {
+	l, ok := c.servedBy(key)
+	if !ok {
+		return "", false
+	}
+	return l.Name, true
+}
+
+// Served returns the name of the layer that served each document
+// loaded so far, by URL
+func (c *Chain) Served() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	served := make(map[string]string, len(c.served))
+	for u, i := range c.served {
+		served[u] = c.layers[i].Name
+	}
+	return served
+}
+
+func (c *Chain) servedBy(key *url.URL) (Layer, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	i, ok := c.served[key.String()]
+	if !ok {
+		return Layer{}, false
+	}
+	return c.layers[i], true
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if the layer that served it records positions
+func (c *Chain) Positions(key *url.URL) (*PositionIndex, bool) {
+	l, ok := c.servedBy(key)
+	if !ok {
+		return nil, false
+	}
+	return positionsOf(l.Provider, key)
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if the layer that served it reports sizes
+func (c *Chain) Size(key *url.URL) (int64, bool) {
+	l, ok := c.servedBy(key)
+	if !ok {
+		return 0, false
+	}
+	return sizeOf(l.Provider, key)
+}
+
+// Reset resets the layers that have a cache, and forgets which layer
+// served each document
+func (c *Chain) Reset() error {
+	c.lock.Lock()
+	c.served = make(map[string]int)
+	c.lock.Unlock()
+
+	for _, l := range c.layers {
+		if err := resetProvider(l.Provider); err != nil {
+			return errors.Wrapf(err, "failed to reset %s", l.Name)
+		}
+	}
+	return nil
+}
+
+// NewMount creates a new Provider that serves the URLs starting with
+// `prefix` from `p`, after replacing the prefix with `target`. For
+// example, to serve "https://example.com/schemas/pet.json" from a
+// local directory:
+//
+//	provider.NewMount("https://example.com/schemas/", "file:///", provider.NewFS(dir))
+//
+// The prefix is matched against the URL as it is written. Dot segments
+// in the rest of the URL are removed before it is appended to
+// `target`, so that they cannot lead out of the mount point.
+func NewMount(prefix, target string, p Provider) *Mount {
+	return &Mount{
+		prefix:   prefix,
+		target:   target,
+		provider: p,
+	}
+}
+
+// Get fetches the document specified by the `key` argument from the
+// mounted provider
+func (m *Mount) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Mount.Get(%s)", key).BindError(&err)
+		defer g.End()
+	}
+
+	u, err := m.translate(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.provider.Get(u)
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if the mounted provider records positions
+func (m *Mount) Positions(key *url.URL) (*PositionIndex, bool) {
+	u, err := m.translate(key)
+	if err != nil {
+		return nil, false
+	}
+	return positionsOf(m.provider, u)
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if the mounted provider reports sizes
+func (m *Mount) Size(key *url.URL) (int64, bool) {
+	u, err := m.translate(key)
+	if err != nil {
+		return 0, false
+	}
+	return sizeOf(m.provider, u)
+}
+
+// Reset resets the mounted provider, if it has a cache
+func (m *Mount) Reset() error {
+	return resetProvider(m.provider)
+}
+
+// translate returns the URL passed to the mounted provider for `key`
+func (m *Mount) translate(key *url.URL) (*url.URL, error) {
+	s := key.String()
+	if !strings.HasPrefix(s, m.prefix) {
+		return nil, errors.Errorf("%s is not under %s", s, m.prefix)
+	}
+
+	rest, err := url.Parse(s[len(m.prefix):])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the mounted part of the URL")
+	}
+	if rest.Scheme != "" || rest.Host != "" || rest.Opaque != "" {
+		return nil, errors.Errorf("%s is not under %s", s, m.prefix)
+	}
+	rest.Path = strings.TrimPrefix(path.Clean("/"+rest.Path), "/")
+	rest.RawPath = ""
+
+	u, err := url.Parse(m.target + rest.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the mounted URL")
+	}
+	return u, nil
+}
+
+// RewriteFunc returns the URL that the document at `u` should be
+// fetched from. `u` may be modified and returned.
+type RewriteFunc func(u *url.URL) (*url.URL, error)
+
+// NewRewrite creates a new Provider that rewrites the URLs using `fn`
+// before passing them to `p`, such as to redirect a host to a mirror
+func NewRewrite(fn RewriteFunc, p Provider) *Rewrite {
+	return &Rewrite{
+		fn:       fn,
+		provider: p,
+	}
+}
+
+// Get fetches the document specified by the rewritten `key` argument
+// from the underlying provider
+func (rw *Rewrite) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Rewrite.Get(%s)", key).BindError(&err)
+		defer g.End()
+	}
+
+	u, err := rw.rewrite(key)
+	if err != nil {
+		return nil, err
+	}
+	return rw.provider.Get(u)
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if the underlying provider records positions
+func (rw *Rewrite) Positions(key *url.URL) (*PositionIndex, bool) {
+	u, err := rw.rewrite(key)
+	if err != nil {
+		return nil, false
+	}
+	return positionsOf(rw.provider, u)
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if the underlying provider reports sizes
+func (rw *Rewrite) Size(key *url.URL) (int64, bool) {
+	u, err := rw.rewrite(key)
+	if err != nil {
+		return 0, false
+	}
+	return sizeOf(rw.provider, u)
+}
+
+// Reset resets the underlying provider, if it has a cache
+func (rw *Rewrite) Reset() error {
+	return resetProvider(rw.provider)
+}
+
+func (rw *Rewrite) rewrite(key *url.URL) (*url.URL, error) {
+	u := *key
+	rewritten, err := rw.fn(&u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrite %s", key)
+	}
+	if rewritten == nil {
+		return nil, errors.Errorf("%s was rewritten to nothing", key)
+	}
+	return rewritten, nil
+}
+
+// positionProvider and sizeProvider are the same as
+// jsref.PositionProvider and jsref.SizeProvider
+type positionProvider interface {
+	Positions(*url.URL) (*PositionIndex, bool)
+}
+
+type sizeProvider interface {
+	Size(*url.URL) (int64, bool)
+}
+
+func positionsOf(p Provider, u *url.URL) (*PositionIndex, bool) {
+	pp, ok := p.(positionProvider)
+	if !ok {
+		return nil, false
+	}
+	return pp.Positions(u)
+}
+
+func sizeOf(p Provider, u *url.URL) (int64, bool) {
+	sp, ok := p.(sizeProvider)
+	if !ok {
+		return 0, false
+	}
+	return sp.Size(u)
+}
+
+func resetProvider(p Provider) error {
+	if r, ok := p.(interface{ Reset() error }); ok {
+		return r.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package provider_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderComposition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsref-compose")
+	if !assert.NoError(t, err, "TempDir should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"pet.json": `{"name": "vendored pet"}`,
+		"tag.json": `{"name": "vendored tag"}`,
+	} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), "WriteFile should succeed") {
+			return
+		}
+	}
+
+	overrides := provider.NewMap()
+	overrides.Set("https://schemas.example.com/v1/pet.json", map[string]interface{}{"name": "overridden pet"})
+	network := provider.NewMap()
+	network.Set("https://schemas.example.com/v1/owner.json", map[string]interface{}{"name": "remote owner"})
+
+	chain := provider.NewChain(
+		provider.Layer{Name: "overrides", Provider: overrides},
+		provider.Layer{Name: "vendor", Provider: provider.NewMount("https://schemas.example.com/v1/", "file:///", provider.NewFS(dir, provider.WithPositions(true)))},
+		provider.Layer{Provider: network},
+	)
+	res := jsref.New()
+	res.AddProvider(chain)
+
+	for doc, expected := range map[string]struct {
+		Name  string
+		Layer string
+	}{
+		"pet.json":             {Name: "overridden pet", Layer: "overrides"},
+		"tag.json":             {Name: "vendored tag", Layer: "vendor"},
+		"owner.json":           {Name: "remote owner", Layer: "layer 2"},
+		"../../../../tag.json": {Name: "vendored tag", Layer: "vendor"},
+	} {
+		ref := "https://schemas.example.com/v1/" + doc
+		v, err := res.Resolve(map[string]interface{}{"$ref": ref + "#/name"}, "")
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", ref) {
+			return
+		}
+		if !assert.Equal(t, expected.Name, v, "Resolve(%s) should return the document from the first layer", ref) {
+			return
+		}
+		u, _ := url.Parse(ref)
+		layer, ok := chain.ServedBy(u)
+		if !assert.True(t, ok, "ServedBy(%s) should be known", ref) {
+			return
+		}
+		if !assert.Equal(t, expected.Layer, layer, "ServedBy(%s) should report the layer", ref) {
+			return
+		}
+	}
+	if !assert.Len(t, chain.Served(), 4, "Served should report every document") {
+		return
+	}
+	u, _ := url.Parse("https://schemas.example.com/v1/tag.json")
+	if _, ok := chain.Positions(u); !assert.True(t, ok, "Positions should be delegated to the layer that served the document") {
+		return
+	}
+
+	u, _ = url.Parse("https://schemas.example.com/v1/missing.json")
+	_, err = chain.Get(u)
+	var cerr *provider.ChainError
+	if !assert.True(t, errors.As(err, &cerr), "Get should fail with a ChainError, got %v", err) {
+		return
+	}
+	if !assert.Len(t, cerr.Errors, 3, "ChainError should hold the error of each layer") {
+		return
+	}
+	if !assert.Equal(t, "vendor", cerr.Errors[1].Layer, "ChainError should name the layers") {
+		return
+	}
+
+	// A layer denying the request by policy stops the search
+	local := provider.NewMap()
+	local.Set("http://127.0.0.1/internal.json", map[string]interface{}{"secret": true})
+	guarded := provider.NewChain(
+		provider.Layer{Name: "network", Provider: provider.NewHTTP(provider.WithBlockPrivateNetworks(true))},
+		provider.Layer{Name: "local", Provider: local},
+	)
+	u, _ = url.Parse("http://127.0.0.1/internal.json")
+	_, err = guarded.Get(u)
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Get should stop at the policy violation, got %v", err) {
+		return
+	}
+
+	// Hosts can be redirected to a mirror
+	mirror := provider.NewMap()
+	mirror.Set("https://mirror.example.com/v1/owner.json", map[string]interface{}{"name": "mirrored owner"})
+	res = jsref.New()
+	res.AddProvider(provider.NewRewrite(func(u *url.URL) (*url.URL, error) {
+		if u.Host != "schemas.example.com" {
+			return nil, errors.New("not mirrored")
+		}
+		u.Host = "mirror.example.com"
+		return u, nil
+	}, mirror))
+	v, err := res.Resolve(map[string]interface{}{"$ref": "https://schemas.example.com/v1/owner.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed through the rewrite") {
+		return
+	}
+	if !assert.Equal(t, "mirrored owner", v, "Resolve should return the mirrored document") {
+		return
+	}
+	_, err = res.Resolve(map[string]interface{}{"$ref": "https://other.example.com/v1/owner.json#/name"}, "")
+	if !assert.Error(t, err, "Resolve should fail when the rewrite fails") {
+		return
+	}
+}
@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// NewData creates a new Provider that serves the documents embedded
+// in "data" URLs, as defined by RFC 2397, such as
+//
+//	data:application/json;base64,eyJuYW1lIjoicGV0In0=#/name
+//	data:application/yaml,name%3A%20pet#/name
+//
+// The content may be base64 or percent-encoded. JSON media types,
+// including the ones with a "+json" suffix, and YAML media types are
+// supported. URLs without a media type are decoded as JSON.
+func NewData(options ...Option) *Data {
+	dp := &Data{
+		mp: NewMap(),
+	}
+	dp.decode.apply(options)
+	return dp
+}
+
+// Get decodes the document embedded in the `key` argument.
+// Note that once a document is decoded, it WILL be cached for the
+// duration of this object, unless you call `Reset`
+func (dp *Data) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Data.Get(%.64s)", key.String()).BindError(&err)
+		defer g.End()
+	}
+
+	if strings.ToLower(key.Scheme) != "data" {
+		return nil, errors.New("unsupported scheme '" + key.Scheme + "'")
+	}
+
+	mpkey := dataKey(key)
+	if x, err := dp.mp.Get(&url.URL{Opaque: mpkey}); err == nil {
+		return x, nil
+	}
+
+	mediaType, buf, err := parseDataURL(mpkey)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *document
+	switch {
+	case isYAMLMediaType(mediaType):
+		if err := dp.decode.checkSize(int64(len(buf))); err != nil {
+			return nil, err
+		}
+		jsonbuf, _, err := jsondoc.YAMLToJSON(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse YAML from data URL")
+		}
+		// Positions would refer to the JSON converted from the YAML
+		// source, rather than to the source itself
+		cfg := dp.decode
+		cfg.positions = false
+		cfg.maxBytes = 0
+		doc, err = cfg.decode(bytes.NewReader(jsonbuf))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse YAML from data URL")
+		}
+		doc.size = int64(len(buf))
+	case isJSONMediaType(mediaType):
+		doc, err = dp.decode.decode(bytes.NewReader(buf))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse JSON from data URL")
+		}
+	default:
+		return nil, errors.Errorf("unsupported media type %q in data URL", mediaType)
+	}
+
+	if err := dp.mp.store(mpkey, doc); err != nil {
+		return nil, errors.Wrap(err, `failed to store data URL`)
+	}
+
+	return doc.value, nil
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if it was loaded with `WithPositions`. Positions
+// are not recorded for YAML documents.
+func (dp *Data) Positions(key *url.URL) (*PositionIndex, bool) {
+	return dp.mp.Positions(&url.URL{Opaque: dataKey(key)})
+}
+
+// Size returns the size of the document specified by the `key`
+// argument, once decoded from base64 or percent-encoding, if it was
+// loaded
+func (dp *Data) Size(key *url.URL) (int64, bool) {
+	return dp.mp.Size(&url.URL{Opaque: dataKey(key)})
+}
+
+// Reset resets the in memory cache of JSON documents
+func (dp *Data) Reset() error {
+	return dp.mp.Reset()
+}
+
+// dataKey returns the data URL in `key`, without its fragment. The
+// query is part of the data, since "?" is not special in data URLs.
+func dataKey(key *url.URL) string {
+	s := "data:" + key.Opaque
+	if key.ForceQuery || key.RawQuery != "" {
+		s += "?" + key.RawQuery
+	}
+	return s
+}
+
+// parseDataURL returns the media type and the content of the data URL
+// `s`, as defined by RFC 2397:
+//
+//	data:[<mediatype>][;base64],<data>
+func parseDataURL(s string) (string, []byte, error) {
+	s = s[len("data:"):]
+	i := strings.IndexByte(s, ',')
+	if i < 0 {
+		return "", nil, errors.New("invalid data URL: missing ','")
+	}
+	meta, data := s[:i], s[i+1:]
+
+	isBase64 := false
+	if j := strings.LastIndexByte(meta, ';'); j >= 0 && strings.EqualFold(strings.TrimSpace(meta[j+1:]), "base64") {
+		isBase64 = true
+		meta = meta[:j]
+	}
+
+	var mediaType string
+	if meta != "" && !strings.HasPrefix(meta, ";") {
+		mt, params, err := mime.ParseMediaType(meta)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "invalid media type in data URL")
+		}
+		if charset, ok := params["charset"]; ok {
+			switch strings.ToLower(charset) {
+			case "utf-8", "utf8", "us-ascii":
+			default:
+				return "", nil, errors.Errorf("unsupported charset %q in data URL", charset)
+			}
+		}
+		mediaType = mt
+	}
+
+	unescaped, err := url.PathUnescape(data)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "invalid percent-encoding in data URL")
+	}
+	if !isBase64 {
+		return mediaType, []byte(unescaped), nil
+	}
+
+	encoded := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, unescaped)
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// Padding is often left out
+		var rerr error
+		buf, rerr = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if rerr != nil {
+			return "", nil, errors.Wrap(err, "invalid base64 in data URL")
+		}
+	}
+	return mediaType, buf, nil
+}
+
+func isJSONMediaType(mt string) bool {
+	switch mt {
+	case "", "application/json", "text/json":
+		return true
+	}
+	return strings.HasSuffix(mt, "+json")
+}
+
+func isYAMLMediaType(mt string) bool {
+	switch mt {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return strings.HasSuffix(mt, "+yaml")
+}
@@ -0,0 +1,88 @@
+package provider_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestData(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString([]byte(`{"name": "pet", "tags": ["a"]}`))
+	yamlDoc := url.PathEscape("name: pet\ntags: [a, b]\nnested:\n  z: 1\n  a: true\n")
+
+	dp := provider.NewData()
+	res := jsref.New()
+	res.AddProvider(dp)
+	for ref, expected := range map[string]interface{}{
+		"data:application/json;base64," + b64 + "#/name":                                          "pet",
+		"data:application/json;base64," + strings.TrimRight(b64, "=") + "#/tags/0":                "a",
+		"data:application/schema+json;charset=utf-8;base64," + b64 + "#/name":                     "pet",
+		"data:application/json," + url.PathEscape(`{"a": {"b": 1}}`) + "#/a/b":                    float64(1),
+		`data:application/json,{"q":"a?b"}#/q`:                                                    "a?b",
+		`data:,{"a":[1,2]}#/a/1`:                                                                  float64(2),
+		"data:application/yaml," + yamlDoc + "#/tags/1":                                           "b",
+		"data:text/yaml;base64," + base64.StdEncoding.EncodeToString([]byte("a: {b: c}")) + "#/a": map[string]interface{}{"b": "c"},
+	} {
+		v, err := res.Resolve(map[string]interface{}{"$ref": ref}, "")
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", ref) {
+			return
+		}
+		if !assert.Equal(t, expected, v, "Resolve(%s) should return the embedded value", ref) {
+			return
+		}
+	}
+
+	u, _ := url.Parse("data:application/json;base64," + b64)
+	if n, ok := dp.Size(u); !assert.True(t, ok, "Size should be known once loaded") || !assert.Equal(t, int64(30), n, "Size should be the decoded size") {
+		return
+	}
+
+	for _, ref := range []string{
+		"data:text/html,%3Cp%3E#/p",
+		"data:application/json;base64,%%%#/a",
+		"data:application/json;base64,not-base64!#/a",
+		"data:application/json#/a",
+		"data:application/json;charset=iso-8859-1,{}#/a",
+		"data:application/json,{#/a",
+	} {
+		_, err := res.Resolve(map[string]interface{}{"$ref": ref}, "")
+		if !assert.Error(t, err, "Resolve(%s) should fail", ref) {
+			return
+		}
+	}
+
+	// Key order and numbers are decoded according to the options
+	res = jsref.New()
+	res.AddProvider(provider.NewData(provider.WithOrderedObjects(true), provider.WithUseNumber(true)))
+	v, err := res.Resolve(map[string]interface{}{"$ref": "data:application/yaml," + yamlDoc + "#/nested"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	buf, err := json.Marshal(v)
+	if !assert.NoError(t, err, "json.Marshal should succeed") {
+		return
+	}
+	if !assert.Equal(t, `{"z":1,"a":true}`, string(buf), "YAML mappings should keep their order") {
+		return
+	}
+
+	// Remote documents may embed documents, but embedded documents
+	// may not reference local files
+	res.ReferencePolicy = jsref.SameOriginPolicy
+	_, err = res.Resolve(map[string]interface{}{"$ref": "data:application/json;base64," + b64 + "#/name"}, "", jsref.WithBaseURI("https://example.com/spec.json"))
+	if !assert.NoError(t, err, "SameOriginPolicy should allow data URLs") {
+		return
+	}
+	nested := "data:application/json," + url.PathEscape(`{"a": {"$ref": "file:///etc/passwd#/"}}`) + "#/a"
+	_, err = res.Resolve(map[string]interface{}{"$ref": nested}, "")
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "SameOriginPolicy should deny file references from data URLs, got %v", err) {
+		return
+	}
+}
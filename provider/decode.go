@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/pkg/errors"
+)
+
+// decodeConfig holds the settings that control how documents are
+// decoded by the providers in this package
+type decodeConfig struct {
+	raw       bool
+	useNumber bool
+	ordered   bool
+	positions bool
+	maxBytes  int64 // zero means no limit
+}
+
+func (c *decodeConfig) apply(options []Option) {
+	for _, option := range options {
+		switch option.Ident() {
+		case identRawJSON{}:
+			c.raw = option.Value().(bool)
+		case identUseNumber{}:
+			c.useNumber = option.Value().(bool)
+		case identOrderedObjects{}:
+			c.ordered = option.Value().(bool)
+		case identPositions{}:
+			c.positions = option.Value().(bool)
+		case identMaxBytes{}:
+			c.maxBytes = option.Value().(int64)
+		}
+	}
+}
+
+// document is a decoded document, along with what is known about
+// its source
+type document struct {
+	value     interface{}
+	positions *PositionIndex // only set if positions were requested
+	size      int64          // size of the source, in bytes
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	src io.Reader
+	n   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (c *decodeConfig) decode(src io.Reader) (*document, error) {
+	if c.maxBytes > 0 {
+		// Read one more byte than allowed, to tell documents of the
+		// maximum size from larger ones
+		src = io.LimitReader(src, c.maxBytes+1)
+	}
+
+	if c.raw || c.positions {
+		buf, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read JSON")
+		}
+		if err := c.checkSize(int64(len(buf))); err != nil {
+			return nil, err
+		}
+		if !json.Valid(buf) {
+			return nil, errors.New("invalid JSON")
+		}
+
+		doc := &document{size: int64(len(buf))}
+		if c.positions {
+			doc.positions, err = jsondoc.IndexPositions(buf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if c.raw {
+			doc.value = json.RawMessage(buf)
+			return doc, nil
+		}
+		doc.value, err = c.decodeValue(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+
+	cr := &countingReader{src: src}
+	x, err := c.decodeValue(cr)
+	// A document cut short by the limit fails to decode, and is
+	// reported as being too large
+	if err := c.checkSize(cr.n); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &document{value: x, size: cr.n}, nil
+}
+
+// checkSize returns an error if `n` bytes exceed the maximum size of
+// a document
+func (c *decodeConfig) checkSize(n int64) error {
+	if c.maxBytes > 0 && n > c.maxBytes {
+		return &jsondoc.LimitError{Limit: "bytes", Max: c.maxBytes}
+	}
+	return nil
+}
+
+func (c *decodeConfig) decodeValue(src io.Reader) (interface{}, error) {
+	return jsondoc.Decode(json.NewDecoder(src), c.useNumber, c.ordered)
+}
@@ -1,7 +1,6 @@
 package provider
 
 import (
-	"encoding/json"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -14,11 +13,13 @@ import (
 // NewFS creates a new Provider that looks for JSON documents
 // from the local file system. Documents are only searched
 // within `root`
-func NewFS(root string) *FS {
-	return &FS{
+func NewFS(root string, options ...Option) *FS {
+	fp := &FS{
 		mp:   NewMap(),
 		Root: root,
 	}
+	fp.decode.apply(options)
+	return fp
 }
 
 // Get fetches the document specified by the `key` argument.
@@ -58,17 +59,30 @@ func (fp *FS) Get(key *url.URL) (out interface{}, err error) {
 	}
 	defer f.Close()
 
-	var x interface{}
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&x); err != nil {
+	doc, err := fp.decode.decode(f)
+	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse JSON local resource")
 	}
 
-	if err := fp.mp.Set(path, x); err != nil {
+	if err := fp.mp.store(path, doc); err != nil {
 		return nil, errors.Wrapf(err, `failed to set value to %q`, path)
 	}
 
-	return x, nil
+	return doc.value, nil
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if it was loaded with `WithPositions`
+func (fp *FS) Positions(key *url.URL) (*PositionIndex, bool) {
+	path := filepath.Clean(filepath.Join(fp.Root, key.Path))
+	return fp.mp.Positions(&url.URL{Path: path})
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if it was loaded
+func (fp *FS) Size(key *url.URL) (int64, bool) {
+	path := filepath.Clean(filepath.Join(fp.Root, key.Path))
+	return fp.mp.Size(&url.URL{Path: path})
 }
 
 // Reset resets the in memory cache of JSON documents
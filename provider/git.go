@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// DefaultGitScheme is the URI scheme served by the Git provider,
+// unless another one is given with `WithScheme`
+const DefaultGitScheme = "git+file"
+
+// NewGit creates a new Provider that reads JSON documents from local
+// Git repositories, at a given commit, tag or branch, without checking
+// them out. Documents are addressed by URIs such as
+//
+//	git+file:///path/to/repo/schemas/pet.json?ref=v1.4.0#/definitions/Pet
+//
+// where the path is the absolute path of the document in the working
+// tree of the repository, and "ref" is any revision understood by
+// `git rev-parse`, "HEAD" by default. The repository is the closest
+// directory on the path that is a Git repository, either bare or not.
+//
+// The `git` command must be available. Its location can be given with
+// `WithGitCommand`.
+func NewGit(options ...GitOption) *Git {
+	gp := &Git{
+		mp:      NewMap(),
+		scheme:  DefaultGitScheme,
+		command: "git",
+		commits: make(map[string]string),
+	}
+	decodeOptions := make([]Option, 0, len(options))
+	for _, o := range options {
+		option := o.gitOption()
+		switch option.Ident() {
+		case identScheme{}:
+			gp.scheme = option.Value().(string)
+		case identGitCommand{}:
+			gp.command = option.Value().(string)
+		default:
+			decodeOptions = append(decodeOptions, option)
+		}
+	}
+	gp.decode.apply(decodeOptions)
+	return gp
+}
+
+// Get fetches the document specified by the `key` argument from the
+// repository, at the revision given by its "ref" query parameter.
+// Revisions are resolved to a commit the first time they are used, and
+// documents are cached by commit, so that branches keep pointing to
+// the same commit for the duration of this object, unless you call
+// `Reset`
+func (gp *Git) Get(key *url.URL) (out interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("provider.Git.Get(%s)", key.String()).BindError(&err)
+		defer g.End()
+	}
+
+	repo, rel, rev, err := gp.locate(key)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := gp.resolve(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	mpkey := gitDocumentKey(repo, commit, rel)
+	if x, err := gp.mp.Get(mpkey); err == nil {
+		return x, nil
+	}
+
+	buf, err := gp.run(repo, "cat-file", "blob", commit+":"+rel)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s at %s", rel, rev)
+	}
+
+	doc, err := gp.decode.decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSON from Git repository")
+	}
+
+	if err := gp.mp.store(mpkey.String(), doc); err != nil {
+		return nil, errors.Wrapf(err, `failed to set value to %q`, mpkey)
+	}
+
+	return doc.value, nil
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if it was loaded with `WithPositions`
+func (gp *Git) Positions(key *url.URL) (*PositionIndex, bool) {
+	mpkey, ok := gp.loadedKey(key)
+	if !ok {
+		return nil, false
+	}
+	return gp.mp.Positions(mpkey)
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if it was loaded
+func (gp *Git) Size(key *url.URL) (int64, bool) {
+	mpkey, ok := gp.loadedKey(key)
+	if !ok {
+		return 0, false
+	}
+	return gp.mp.Size(mpkey)
+}
+
+// Reset resets the in memory cache of JSON documents, and forgets
+// which commits the revisions were resolved to
+func (gp *Git) Reset() error {
+	gp.lock.Lock()
+	gp.commits = make(map[string]string)
+	gp.lock.Unlock()
+	return gp.mp.Reset()
+}
+
+// locate returns the repository containing the document at `key`, the
+// path of the document within the repository, and the revision
+func (gp *Git) locate(key *url.URL) (repo, rel, rev string, err error) {
+	if !strings.EqualFold(key.Scheme, gp.scheme) {
+		return "", "", "", errors.New("unsupported scheme '" + key.Scheme + "'")
+	}
+
+	rev = key.Query().Get("ref")
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if strings.HasPrefix(rev, "-") {
+		return "", "", "", errors.Errorf("invalid revision %q", rev)
+	}
+
+	path := filepath.Clean(filepath.FromSlash(key.Path))
+	if !filepath.IsAbs(path) {
+		return "", "", "", errors.Errorf("path %q is not absolute", key.Path)
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if isGitRepository(dir) {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return "", "", "", errors.Wrap(err, "failed to compute path within repository")
+			}
+			return dir, filepath.ToSlash(rel), rev, nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return "", "", "", errors.Errorf("%s is not within a Git repository", path)
+}
+
+// loadedKey returns the key of the document at `key` in the cache, if
+// its revision was already resolved
+func (gp *Git) loadedKey(key *url.URL) (*url.URL, bool) {
+	repo, rel, rev, err := gp.locate(key)
+	if err != nil {
+		return nil, false
+	}
+
+	gp.lock.Lock()
+	commit, ok := gp.commits[repo+"\x00"+rev]
+	gp.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return gitDocumentKey(repo, commit, rel), true
+}
+
+// resolve returns the commit that `rev` points to in `repo`
+func (gp *Git) resolve(repo, rev string) (string, error) {
+	ckey := repo + "\x00" + rev
+	gp.lock.Lock()
+	commit, ok := gp.commits[ckey]
+	gp.lock.Unlock()
+	if ok {
+		return commit, nil
+	}
+
+	out, err := gp.run(repo, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve revision %q", rev)
+	}
+	commit = strings.TrimSpace(string(out))
+
+	gp.lock.Lock()
+	gp.commits[ckey] = commit
+	gp.lock.Unlock()
+	return commit, nil
+}
+
+// run runs a git command in `repo`, and returns its output
+func (gp *Git) run(repo string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gp.command, append([]string{"-C", repo}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Wrap(err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitDocumentKey returns the key of a document in the cache. The
+// cache looks documents up by the string form of the key, so it is
+// also the key the documents are stored under.
+func gitDocumentKey(repo, commit, rel string) *url.URL {
+	return &url.URL{Path: repo + "@" + commit + ":" + rel}
+}
+
+// isGitRepository returns true if `dir` is the root of a working tree,
+// or a bare repository
+func isGitRepository(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
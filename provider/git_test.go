@@ -0,0 +1,120 @@
+package provider_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// The space checks that documents are cached under the key they
+	// are looked up with
+	dir, err := ioutil.TempDir("", "jsref git")
+	if !assert.NoError(t, err, "TempDir should succeed") {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(version int) {
+		buf := []byte(`{"definitions": {"Pet": {"version": ` + strconv.Itoa(version) + `}}}`)
+		if err := ioutil.WriteFile(filepath.Join(dir, "schemas", "pet.json"), buf, 0644); err != nil {
+			t.Fatalf("failed to write schema: %s", err)
+		}
+		git("add", ".")
+		git("commit", "-q", "-m", "version "+strconv.Itoa(version))
+	}
+
+	git("init", "-q")
+	if !assert.NoError(t, os.Mkdir(filepath.Join(dir, "schemas"), 0755), "Mkdir should succeed") {
+		return
+	}
+	commit(1)
+	git("tag", "v1")
+	first := git("rev-parse", "HEAD")
+	commit(2)
+
+	gp := provider.NewGit()
+	res := jsref.New()
+	res.AddProvider(gp)
+
+	base := "git+file://" + filepath.ToSlash(filepath.Join(dir, "schemas", "pet.json"))
+	for query, expected := range map[string]float64{"": 2, "?ref=HEAD": 2, "?ref=v1": 1, "?ref=" + first: 1, "?ref=HEAD~1": 1} {
+		v, err := res.Resolve(map[string]interface{}{"$ref": base + query + "#/definitions/Pet/version"}, "")
+		if !assert.NoError(t, err, "Resolve(%s) should succeed", query) {
+			return
+		}
+		if !assert.Equal(t, expected, v, "Resolve(%s) should return the version at that revision", query) {
+			return
+		}
+	}
+
+	u, err := url.Parse(base + "?ref=v1")
+	if !assert.NoError(t, err, "url.Parse should succeed") {
+		return
+	}
+	if n, ok := gp.Size(u); !assert.True(t, ok, "Size should be known once loaded") || !assert.Equal(t, int64(40), n, "Size should be the size of the document") {
+		return
+	}
+
+	// Revisions are resolved once, until the provider is reset
+	commit(3)
+	v, err := res.Resolve(map[string]interface{}{"$ref": base + "#/definitions/Pet/version"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, float64(2), v, "Resolve should use the cached revision") {
+		return
+	}
+	if !assert.NoError(t, gp.Reset(), "Reset should succeed") {
+		return
+	}
+	v, err = res.Resolve(map[string]interface{}{"$ref": base + "#/definitions/Pet/version"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed") {
+		return
+	}
+	if !assert.Equal(t, float64(3), v, "Resolve should use the new revision after Reset") {
+		return
+	}
+
+	for _, ref := range []string{
+		base + "?ref=v2#/definitions",
+		base + "?ref=--help#/definitions",
+		"git+file://" + filepath.ToSlash(filepath.Join(dir, "schemas", "missing.json")) + "#/definitions",
+	} {
+		_, err := res.Resolve(map[string]interface{}{"$ref": ref}, "")
+		if !assert.Error(t, err, "Resolve(%s) should fail", ref) {
+			return
+		}
+	}
+
+	res = jsref.New()
+	res.AddProvider(provider.NewGit(provider.WithScheme("schemas")))
+	v, err = res.Resolve(map[string]interface{}{"$ref": "schemas://" + filepath.ToSlash(filepath.Join(dir, "schemas", "pet.json")) + "?ref=v1#/definitions/Pet/version"}, "")
+	if !assert.NoError(t, err, "Resolve should succeed with a custom scheme") {
+		return
+	}
+	if !assert.Equal(t, float64(1), v, "Resolve should return the version at v1") {
+		return
+	}
+}
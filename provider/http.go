@@ -1,7 +1,7 @@
 package provider
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,15 +11,18 @@ import (
 	"github.com/pkg/errors"
 )
 
-// NewFS creates a new Provider that looks for JSON documents
-// from the internet over HTTP(s)
-func NewHTTP() *HTTP {
-	return &HTTP{
-		mp: NewMap(),
-		Client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
+// NewHTTP creates a new Provider that looks for JSON documents
+// from the internet over HTTP(s). The options control both how the
+// documents are decoded, and how the requests are made.
+func NewHTTP(options ...Option) *HTTP {
+	var cfg httpConfig
+	cfg.apply(options)
+	hp := &HTTP{
+		mp:     NewMap(),
+		Client: cfg.client(),
 	}
+	hp.decode.apply(options)
+	return hp
 }
 
 // Get fetches the document specified by the `key` argument, making
@@ -49,17 +52,191 @@ func (hp *HTTP) Get(key *url.URL) (interface{}, error) {
 	}
 	defer res.Body.Close()
 
-	dec := json.NewDecoder(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.Errorf("failed to fetch HTTP resource: unexpected status %s", res.Status)
+	}
 
-	var x interface{}
-	if err := dec.Decode(&x); err != nil {
+	doc, err := hp.decode.decode(res.Body)
+	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse JSON from HTTP resource")
 	}
 
-	return x, nil
+	if err := hp.mp.store(key.String(), doc); err != nil {
+		return nil, errors.Wrapf(err, `failed to set value to %q`, key.String())
+	}
+
+	return doc.value, nil
+}
+
+// Positions returns the position index of the document specified by
+// the `key` argument, if it was loaded with `WithPositions`
+func (hp *HTTP) Positions(key *url.URL) (*PositionIndex, bool) {
+	return hp.mp.Positions(key)
+}
+
+// Size returns the size of the source of the document specified by
+// the `key` argument, if it was fetched
+func (hp *HTTP) Size(key *url.URL) (int64, bool) {
+	return hp.mp.Size(key)
 }
 
 // Reset resets the in memory cache of JSON documents
 func (hp *HTTP) Reset() error {
 	return hp.mp.Reset()
 }
+
+// httpConfig holds the settings that control how the HTTP provider
+// makes requests
+type httpConfig struct {
+	timeout     time.Duration
+	transport   http.RoundTripper
+	tlsConfig   *tls.Config
+	credentials map[string]Credentials
+	netrc       *netrc
+	headers     http.Header
+	hostHeaders map[string]http.Header
+	retry       *RetryPolicy
+	rateLimits  map[string]rateLimit
+	snapshot    *snapshotConfig
+	policy      requestPolicy
+	maxBytes    int64 // of the responses that are recorded
+}
+
+func (c *httpConfig) apply(options []Option) {
+	for _, option := range options {
+		switch option.Ident() {
+		case identTimeout{}:
+			c.timeout = option.Value().(time.Duration)
+		case identTransport{}:
+			c.transport = option.Value().(http.RoundTripper)
+		case identTLSConfig{}:
+			c.tlsConfig = option.Value().(*tls.Config)
+		case identCredentials{}:
+			hc := option.Value().(hostCredentials)
+			if c.credentials == nil {
+				c.credentials = make(map[string]Credentials)
+			}
+			c.credentials[strings.ToLower(hc.host)] = hc.credentials
+		case identNetrc{}:
+			c.netrc = &netrc{path: option.Value().(string)}
+		case identHeader{}:
+			h := option.Value().(hostHeader)
+			if h.host == "" {
+				if c.headers == nil {
+					c.headers = make(http.Header)
+				}
+				c.headers.Add(h.name, h.value)
+				continue
+			}
+			if c.hostHeaders == nil {
+				c.hostHeaders = make(map[string]http.Header)
+			}
+			host := strings.ToLower(h.host)
+			if c.hostHeaders[host] == nil {
+				c.hostHeaders[host] = make(http.Header)
+			}
+			c.hostHeaders[host].Add(h.name, h.value)
+		case identMaxBytes{}:
+			c.maxBytes = option.Value().(int64)
+		case identSnapshot{}:
+			sc := option.Value().(snapshotConfig)
+			c.snapshot = &sc
+		case identRetry{}:
+			p := option.Value().(RetryPolicy).withDefaults()
+			c.retry = &p
+		case identAllowedHosts{}:
+			c.policy.allowedHosts = append(c.policy.allowedHosts, option.Value().([]string)...)
+		case identDeniedHosts{}:
+			c.policy.deniedHosts = append(c.policy.deniedHosts, option.Value().([]string)...)
+		case identAllowedPorts{}:
+			if c.policy.allowedPorts == nil {
+				c.policy.allowedPorts = make(map[int]struct{})
+			}
+			for _, port := range option.Value().([]int) {
+				c.policy.allowedPorts[port] = struct{}{}
+			}
+		case identBlockPrivateNetworks{}:
+			c.policy.blockPrivate = option.Value().(bool)
+		case identRateLimit{}:
+			l := option.Value().(rateLimit)
+			if c.rateLimits == nil {
+				c.rateLimits = make(map[string]rateLimit)
+			}
+			if l.rate <= 0 {
+				delete(c.rateLimits, strings.ToLower(l.host))
+				continue
+			}
+			c.rateLimits[strings.ToLower(l.host)] = l
+		}
+	}
+}
+
+// client builds the http.Client described by the configuration
+func (c *httpConfig) client() *http.Client {
+	timeout := c.timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	var base http.RoundTripper
+	var guarded bool
+	if c.snapshot != nil && c.snapshot.mode == SnapshotReplay {
+		// Replayed requests never connect anywhere, so there are no
+		// addresses to check. The requests themselves still go through
+		// the policy, credentials and headers below.
+		base, guarded = &replayTransport{dir: c.snapshot.dir}, true
+	} else {
+		base = c.transport
+		if c.tlsConfig != nil {
+			if base == nil {
+				base = http.DefaultTransport
+			}
+			if t, ok := base.(*http.Transport); ok {
+				t = t.Clone()
+				t.TLSClientConfig = c.tlsConfig
+				base = t
+			}
+		}
+		if base == nil {
+			base = http.DefaultTransport
+		}
+
+		if c.policy.blockPrivate {
+			base, guarded = c.policy.guard(base)
+		}
+
+		if c.snapshot != nil && c.snapshot.mode == SnapshotRecord {
+			base = &recordTransport{next: base, dir: c.snapshot.dir, maxBytes: c.maxBytes}
+		}
+	}
+
+	// Credentials are applied to each attempt, after waiting for the
+	// rate limiter, so that they are as fresh as possible
+	var rt http.RoundTripper = &authTransport{
+		base:        base,
+		credentials: c.credentials,
+		netrc:       c.netrc,
+		headers:     c.headers,
+		hostHeaders: c.hostHeaders,
+	}
+	if len(c.rateLimits) > 0 {
+		rt = &rateLimitTransport{
+			next:    rt,
+			limits:  c.rateLimits,
+			buckets: make(map[string]*tokenBucket),
+		}
+	}
+	if c.retry != nil {
+		rt = &retryTransport{next: rt, policy: *c.retry}
+	}
+	if c.policy.enabled() {
+		// The policy is checked first, and for each redirect, so that
+		// denied requests are neither retried nor rate limited
+		rt = &policyTransport{next: rt, policy: &c.policy, guarded: guarded}
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: rt,
+	}
+}
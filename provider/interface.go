@@ -1,21 +1,74 @@
 package provider
 
 import (
+	"io"
 	"net/http"
+	"net/url"
 	"sync"
 )
 
+// Provider is the interface that the providers combined by Chain,
+// Mount and Rewrite implement. It is the same as jsref.Provider.
+type Provider interface {
+	Get(*url.URL) (interface{}, error)
+}
+
+type Chain struct {
+	layers []Layer
+
+	lock   sync.Mutex
+	served map[string]int // index of the layer that served each URL
+}
+
+type Mount struct {
+	prefix   string
+	target   string
+	provider Provider
+}
+
+type Rewrite struct {
+	fn       RewriteFunc
+	provider Provider
+}
+
+type Data struct {
+	mp     *Map
+	decode decodeConfig
+}
+
 type FS struct {
-	mp   *Map
-	Root string
+	mp     *Map
+	decode decodeConfig
+	Root   string
 }
 
 type HTTP struct {
 	mp     *Map
+	decode decodeConfig
 	Client *http.Client
 }
 
-type Map struct {
+type Archive struct {
+	mp      *Map
+	decode  decodeConfig
+	name    string                   // URI of the archive, as used in jar: URIs
+	members map[string]archiveMember // by cleaned path, without leading slash
+	closer  io.Closer
+}
+
+type Git struct {
+	mp      *Map
+	decode  decodeConfig
+	scheme  string
+	command string
+
 	lock    sync.Mutex
-	mapping map[string]interface{}
+	commits map[string]string // by repository and revision
+}
+
+type Map struct {
+	lock      sync.Mutex
+	mapping   map[string]interface{}
+	positions map[string]*PositionIndex
+	sizes     map[string]int64
 }
@@ -9,7 +9,9 @@ import (
 
 func NewMap() *Map {
 	return &Map{
-		mapping: make(map[string]interface{}),
+		mapping:   make(map[string]interface{}),
+		positions: make(map[string]*PositionIndex),
+		sizes:     make(map[string]int64),
 	}
 }
 
@@ -38,10 +40,65 @@ func (mp *Map) Get(key *url.URL) (res interface{}, err error) {
 	return v, nil
 }
 
+// SetPositions associates the position index of the source of the
+// document stored under `key`
+func (mp *Map) SetPositions(key string, idx *PositionIndex) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.positions[key] = idx
+	return nil
+}
+
+// Positions returns the position index associated with the document
+// stored under `key`, if any
+func (mp *Map) Positions(key *url.URL) (*PositionIndex, bool) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	idx, ok := mp.positions[key.String()]
+	return idx, ok
+}
+
+// SetSize records the size in bytes of the source of the document
+// stored under `key`
+func (mp *Map) SetSize(key string, n int64) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.sizes[key] = n
+	return nil
+}
+
+// Size returns the size recorded for the document stored under `key`,
+// if any
+func (mp *Map) Size(key *url.URL) (int64, bool) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	n, ok := mp.sizes[key.String()]
+	return n, ok
+}
+
 func (mp *Map) Reset() error {
 	mp.lock.Lock()
 	defer mp.lock.Unlock()
 
 	mp.mapping = make(map[string]interface{})
+	mp.positions = make(map[string]*PositionIndex)
+	mp.sizes = make(map[string]int64)
+	return nil
+}
+
+// store saves a document decoded by a provider under `key`
+func (mp *Map) store(key string, doc *document) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.mapping[key] = doc.value
+	mp.sizes[key] = doc.size
+	if doc.positions != nil {
+		mp.positions[key] = doc.positions
+	}
 	return nil
 }
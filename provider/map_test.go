@@ -0,0 +1,38 @@
+package provider_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapPositions(t *testing.T) {
+	src := []byte("{\n  \"name\": \"pet\"\n}")
+	idx, err := provider.IndexPositions(src)
+	if !assert.NoError(t, err, "IndexPositions should succeed") {
+		return
+	}
+
+	mp := provider.NewMap()
+	if !assert.NoError(t, mp.Set("mem:pet", map[string]interface{}{"name": "pet"}), "Set should succeed") {
+		return
+	}
+	if !assert.NoError(t, mp.SetPositions("mem:pet", idx), "SetPositions should succeed") {
+		return
+	}
+
+	u, _ := url.Parse("mem:pet")
+	got, ok := mp.Positions(u)
+	if !assert.True(t, ok, "Positions should be known") {
+		return
+	}
+	pos, ok := got.Lookup("/name")
+	if !assert.True(t, ok, "Lookup(/name) should succeed") {
+		return
+	}
+	if !assert.Equal(t, provider.Position{Line: 2, Column: 11, Offset: 12}, pos, "Lookup(/name) should return the position of the value") {
+		return
+	}
+}
@@ -0,0 +1,244 @@
+package provider
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/lestrrat-go/option"
+)
+
+type Option = option.Interface
+
+// DecodeOption is an option that controls how documents are decoded.
+// It is accepted by all the providers that read documents, including
+// `NewGit`.
+type DecodeOption interface {
+	Option
+	GitOption
+}
+
+// GitOption is an option accepted by `NewGit`: either a DecodeOption,
+// or one of the options specific to the Git provider, such as
+// `WithScheme`. Options specific to the Git provider cannot be passed
+// to the other providers.
+type GitOption interface {
+	gitOption() Option
+}
+
+type decodeOption struct {
+	Option
+}
+
+func (o decodeOption) gitOption() Option {
+	return o.Option
+}
+
+type gitOption struct {
+	Option
+}
+
+func (o gitOption) gitOption() Option {
+	return o.Option
+}
+
+type identRawJSON struct{}
+type identUseNumber struct{}
+type identOrderedObjects struct{}
+type identPositions struct{}
+type identMaxBytes struct{}
+
+// WithRawJSON specifies that documents should be returned as
+// `json.RawMessage` instead of being decoded into Go values.
+// `jsref.Resolver` evaluates JSON pointers against raw documents
+// by scanning them, only decoding the parts that are referenced.
+func WithRawJSON(b bool) DecodeOption {
+	return decodeOption{option.New(identRawJSON{}, b)}
+}
+
+// WithUseNumber specifies that numbers should be decoded as
+// `json.Number` instead of float64, so that integers larger than
+// 2^53 keep their precision.
+func WithUseNumber(b bool) DecodeOption {
+	return decodeOption{option.New(identUseNumber{}, b)}
+}
+
+// WithOrderedObjects specifies that objects should be decoded as
+// `*jsref.OrderedMap`, which preserves the order of their keys when
+// the resolved values are marshaled back into JSON.
+func WithOrderedObjects(b bool) DecodeOption {
+	return decodeOption{option.New(identOrderedObjects{}, b)}
+}
+
+// WithPositions specifies that the position of each value in the
+// source of the documents should be recorded, so that the resolver
+// can report line and column numbers in errors and source maps.
+func WithPositions(b bool) DecodeOption {
+	return decodeOption{option.New(identPositions{}, b)}
+}
+
+// WithMaxBytes specifies the maximum size of the source of a document.
+// Reading stops as soon as a document is larger, and a
+// `*jsref.LimitError` is returned. Zero means that there is no limit.
+func WithMaxBytes(n int64) DecodeOption {
+	return decodeOption{option.New(identMaxBytes{}, n)}
+}
+
+type identTimeout struct{}
+type identTransport struct{}
+type identTLSConfig struct{}
+type identCredentials struct{}
+type identNetrc struct{}
+type identHeader struct{}
+
+type hostCredentials struct {
+	host        string
+	credentials Credentials
+}
+
+type hostHeader struct {
+	host  string
+	name  string
+	value string
+}
+
+// WithTimeout specifies the timeout of the requests made by the HTTP
+// provider. The default is 5 seconds.
+func WithTimeout(d time.Duration) Option {
+	return option.New(identTimeout{}, d)
+}
+
+// WithTransport specifies the http.RoundTripper used by the HTTP
+// provider to make requests. `http.DefaultTransport` is used by
+// default.
+func WithTransport(rt http.RoundTripper) Option {
+	return option.New(identTransport{}, rt)
+}
+
+// WithTLSConfig specifies the TLS configuration used by the HTTP
+// provider, such as client certificates for mutual TLS or additional
+// root CAs. It applies to a copy of the transport given with
+// `WithTransport`, and has no effect if that transport is not an
+// `*http.Transport`.
+func WithTLSConfig(c *tls.Config) Option {
+	return option.New(identTLSConfig{}, c)
+}
+
+// WithCredentials specifies the credentials used for requests made by
+// the HTTP provider to `host`. If `host` has a port, such as
+// "example.com:8443", the credentials are only used for that port.
+// Credentials are only sent to the host they are registered for, and
+// are not forwarded when a redirect leads to another host.
+func WithCredentials(host string, c Credentials) Option {
+	return option.New(identCredentials{}, hostCredentials{host: host, credentials: c})
+}
+
+// WithNetrc specifies that credentials for the hosts that have none
+// registered with `WithCredentials` should be looked up in the netrc
+// file at `path`. If `path` is empty, the file named by the NETRC
+// environment variable, or ~/.netrc, is used.
+func WithNetrc(path string) Option {
+	return option.New(identNetrc{}, path)
+}
+
+// WithHeader specifies a header sent with every request made by the
+// HTTP provider, such as "Accept". Use `WithCredentials` for headers
+// that carry secrets, since headers given here are sent to every host.
+func WithHeader(name, value string) Option {
+	return option.New(identHeader{}, hostHeader{name: name, value: value})
+}
+
+// WithHostHeader specifies a header sent with the requests made by the
+// HTTP provider to `host`. Headers registered for a host replace the
+// headers of the same name given with `WithHeader`.
+func WithHostHeader(host, name, value string) Option {
+	return option.New(identHeader{}, hostHeader{host: host, name: name, value: value})
+}
+
+type identRetry struct{}
+type identRateLimit struct{}
+
+// WithRetry specifies that the HTTP provider should retry requests that
+// failed because of a transient error, following `p`. Requests are not
+// retried by default. The timeout given with `WithTimeout` applies to
+// all the attempts of a request together.
+func WithRetry(p RetryPolicy) Option {
+	return option.New(identRetry{}, p)
+}
+
+// WithRateLimit limits the requests made by the HTTP provider to `host`
+// to `rate` requests per second, allowing bursts of up to `burst`
+// requests. If `host` is empty, the limit applies to each host that has
+// no limit of its own.
+func WithRateLimit(host string, rate float64, burst int) Option {
+	return option.New(identRateLimit{}, rateLimit{host: host, rate: rate, burst: burst})
+}
+
+type identSnapshot struct{}
+
+// WithSnapshot specifies that the HTTP provider should record the
+// documents it fetches in the directory `dir`, or replay them from it,
+// depending on `mode`. Recording adds to the documents already in the
+// directory. The directory holds one file per document, along with a
+// "manifest.json" file that maps URLs to the files.
+//
+// When replaying, the network is never accessed, but the requests are
+// still made with the other options, so that host restrictions,
+// credentials and headers apply as they would to live requests.
+func WithSnapshot(dir string, mode SnapshotMode) Option {
+	return option.New(identSnapshot{}, snapshotConfig{dir: dir, mode: mode})
+}
+
+type identAllowedHosts struct{}
+type identDeniedHosts struct{}
+type identAllowedPorts struct{}
+type identBlockPrivateNetworks struct{}
+
+// WithAllowedHosts restricts the requests made by the HTTP provider,
+// including the ones made when following redirects, to `hosts`. Each
+// host is either a name or an IP address, or "*." followed by a domain
+// to allow any of its subdomains, as in "*.example.com". Using the
+// option several times adds to the list. Any host is allowed by default.
+func WithAllowedHosts(hosts ...string) Option {
+	return option.New(identAllowedHosts{}, hosts)
+}
+
+// WithDeniedHosts denies the requests made by the HTTP provider to
+// `hosts`, which are given as with `WithAllowedHosts`. Hosts that are
+// both allowed and denied are denied.
+func WithDeniedHosts(hosts ...string) Option {
+	return option.New(identDeniedHosts{}, hosts)
+}
+
+// WithAllowedPorts restricts the requests made by the HTTP provider to
+// `ports`. Any port is allowed by default.
+func WithAllowedPorts(ports ...int) Option {
+	return option.New(identAllowedPorts{}, ports)
+}
+
+// WithBlockPrivateNetworks specifies that the HTTP provider should not
+// connect to loopback, private, link-local, multicast and unspecified
+// addresses, such as 127.0.0.1, 10.0.0.1 or 169.254.169.254. Addresses
+// are checked when connecting, after host names are resolved, so that
+// names pointing to such addresses are denied as well.
+//
+// The check requires the transport given with `WithTransport` to be an
+// `*http.Transport`; requests fail otherwise. Proxies are not used, as
+// they would connect on behalf of the provider.
+func WithBlockPrivateNetworks(b bool) Option {
+	return option.New(identBlockPrivateNetworks{}, b)
+}
+
+type identScheme struct{}
+type identGitCommand struct{}
+
+// WithScheme specifies the URI scheme served by the Git provider
+func WithScheme(s string) GitOption {
+	return gitOption{option.New(identScheme{}, s)}
+}
+
+// WithGitCommand specifies the `git` executable used by the Git
+// provider. By default, "git" is looked up in the PATH.
+func WithGitCommand(path string) GitOption {
+	return gitOption{option.New(identGitCommand{}, path)}
+}
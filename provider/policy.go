@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+)
+
+// PolicyViolationError is returned by the HTTP provider when a request
+// is denied by the options that restrict the hosts, ports and
+// addresses it may connect to
+type PolicyViolationError struct {
+	// URL is the URL of the denied request. It is empty if the request
+	// was denied when connecting, in which case Address is set.
+	URL string
+	// Address is the address that the provider refused to connect to
+	Address string
+	// Reason describes why the request was denied
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	target := e.URL
+	if target == "" {
+		target = e.Address
+	}
+	return fmt.Sprintf("request to %s %s: %s", target, jsondoc.ErrPolicyViolation, e.Reason)
+}
+
+func (e *PolicyViolationError) Is(target error) bool {
+	return target == jsondoc.ErrPolicyViolation
+}
+
+// requestPolicy restricts the destinations of the requests made by
+// the HTTP provider
+type requestPolicy struct {
+	allowedHosts []string // empty means any host
+	deniedHosts  []string
+	allowedPorts map[int]struct{} // empty means any port
+	blockPrivate bool
+}
+
+func (p *requestPolicy) enabled() bool {
+	return len(p.allowedHosts) > 0 || len(p.deniedHosts) > 0 || len(p.allowedPorts) > 0 || p.blockPrivate
+}
+
+// checkRequest verifies the URL of `req`. Hosts given as IP addresses
+// are checked right away, names are checked once resolved, when
+// connecting.
+func (p *requestPolicy) checkRequest(req *http.Request) error {
+	deny := func(reason string, args ...interface{}) error {
+		return &PolicyViolationError{URL: req.URL.String(), Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	switch strings.ToLower(req.URL.Scheme) {
+	case "http", "https":
+	default:
+		return deny("scheme %q is not allowed", req.URL.Scheme)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(req.URL.Hostname(), "."))
+	for _, pattern := range p.deniedHosts {
+		if matchHostPattern(pattern, host) {
+			return deny("host %s is denied", host)
+		}
+	}
+	if len(p.allowedHosts) > 0 {
+		allowed := false
+		for _, pattern := range p.allowedHosts {
+			if matchHostPattern(pattern, host) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return deny("host %s is not allowed", host)
+		}
+	}
+
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(req.URL.Scheme, "https") {
+			port = "443"
+		}
+	}
+	if reason := p.checkPort(port); reason != "" {
+		return deny("%s", reason)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if reason := p.checkIP(ip); reason != "" {
+			return deny("%s", reason)
+		}
+	}
+	return nil
+}
+
+func (p *requestPolicy) checkPort(port string) string {
+	if len(p.allowedPorts) == 0 {
+		return ""
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Sprintf("invalid port %q", port)
+	}
+	if _, ok := p.allowedPorts[n]; !ok {
+		return fmt.Sprintf("port %d is not allowed", n)
+	}
+	return ""
+}
+
+func (p *requestPolicy) checkIP(ip net.IP) string {
+	if !p.blockPrivate {
+		return ""
+	}
+	switch {
+	case ip.IsLoopback():
+		return fmt.Sprintf("%s is a loopback address", ip)
+	case ip.IsPrivate():
+		return fmt.Sprintf("%s is a private address", ip)
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return fmt.Sprintf("%s is a link-local address", ip)
+	case ip.IsUnspecified():
+		return fmt.Sprintf("%s is an unspecified address", ip)
+	case ip.IsInterfaceLocalMulticast(), ip.IsMulticast():
+		return fmt.Sprintf("%s is a multicast address", ip)
+	case sharedAddressSpace.Contains(ip):
+		return fmt.Sprintf("%s is a shared address", ip)
+	}
+	return ""
+}
+
+// sharedAddressSpace is used for carrier-grade NAT (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// control is used as `net.Dialer.Control`, and checks the address that
+// a host name was resolved to, right before connecting to it. This
+// prevents names that resolve to internal addresses from bypassing the
+// policy, including by changing what they resolve to after the request
+// was checked.
+func (p *requestPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return &PolicyViolationError{Address: address, Reason: "invalid address"}
+	}
+	if reason := p.checkPort(port); reason != "" {
+		return &PolicyViolationError{Address: address, Reason: reason}
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &PolicyViolationError{Address: address, Reason: "address is not an IP address"}
+	}
+	if reason := p.checkIP(ip); reason != "" {
+		return &PolicyViolationError{Address: address, Reason: reason}
+	}
+	return nil
+}
+
+// guard returns a copy of `base` that checks the addresses it connects
+// to, or false if `base` cannot be guarded
+func (p *requestPolicy) guard(base http.RoundTripper) (http.RoundTripper, bool) {
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base, false
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	t = t.Clone()
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	t.Dial = nil
+	t.DialTLS = nil
+	t.DialTLSContext = nil
+	// The address of the destination cannot be checked when the
+	// connection goes through a proxy
+	t.Proxy = nil
+	return t, true
+}
+
+// policyTransport checks each request, including the ones made when
+// following redirects, against the policy
+type policyTransport struct {
+	next    http.RoundTripper
+	policy  *requestPolicy
+	guarded bool // true if the addresses are checked when connecting
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.checkRequest(req); err != nil {
+		return nil, err
+	}
+	if t.policy.blockPrivate && !t.guarded {
+		// Fail closed, rather than letting names resolve to any address
+		return nil, &PolicyViolationError{URL: req.URL.String(), Reason: "the transport does not allow checking the addresses it connects to"}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// matchHostPattern returns true if `host` matches `pattern`, which is
+// either a host name or an IP address, or "*." followed by a domain
+// to match any of its subdomains
+func matchHostPattern(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	if pip, hip := net.ParseIP(pattern), net.ParseIP(host); pip != nil && hip != nil {
+		return pip.Equal(hip)
+	}
+	return pattern == host
+}
@@ -0,0 +1,111 @@
+package provider_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect.json" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer srv.Close()
+
+	su, err := url.Parse(srv.URL)
+	if !assert.NoError(t, err, "url.Parse should succeed") {
+		return
+	}
+	port, _ := strconv.Atoi(su.Port())
+	byName := "http://localhost:" + su.Port()
+
+	resolve := func(hp *provider.HTTP, target string) error {
+		res := jsref.New()
+		res.AddProvider(hp)
+		_, err := res.Resolve(map[string]interface{}{"$ref": target + "#/ok"}, "")
+		return err
+	}
+
+	allowed := []struct {
+		Name    string
+		Options []provider.Option
+	}{
+		{Name: "no policy"},
+		{Name: "allowed host", Options: []provider.Option{provider.WithAllowedHosts("example.com", su.Hostname())}},
+		{Name: "allowed port", Options: []provider.Option{provider.WithAllowedPorts(443, port)}},
+		{Name: "other host denied", Options: []provider.Option{provider.WithDeniedHosts("*.example.com")}},
+	}
+	for _, set := range allowed {
+		hp := provider.NewHTTP(set.Options...)
+		if !assert.NoError(t, resolve(hp, srv.URL+"/doc.json"), "%s: Resolve should succeed", set.Name) {
+			return
+		}
+	}
+
+	denied := []struct {
+		Name    string
+		Target  string
+		Options []provider.Option
+		Address bool // denied when connecting
+	}{
+		{Name: "host not allowed", Target: srv.URL + "/doc.json", Options: []provider.Option{provider.WithAllowedHosts("*.example.com")}},
+		{Name: "host denied", Target: srv.URL + "/doc.json", Options: []provider.Option{provider.WithAllowedHosts(su.Hostname()), provider.WithDeniedHosts(su.Hostname())}},
+		{Name: "port not allowed", Target: srv.URL + "/doc.json", Options: []provider.Option{provider.WithAllowedPorts(80, 443)}},
+		{Name: "loopback address", Target: srv.URL + "/doc.json", Options: []provider.Option{provider.WithBlockPrivateNetworks(true)}},
+		{Name: "name resolving to loopback", Target: byName + "/doc.json", Options: []provider.Option{provider.WithBlockPrivateNetworks(true)}, Address: true},
+		{Name: "link-local address", Target: "http://169.254.169.254/doc.json", Options: []provider.Option{provider.WithBlockPrivateNetworks(true)}},
+		{Name: "unguarded transport", Target: byName + "/doc.json", Options: []provider.Option{provider.WithBlockPrivateNetworks(true), provider.WithTransport(http.NewFileTransport(http.Dir(".")))}},
+		{Name: "redirect to host not allowed", Target: srv.URL + "/redirect.json?to=" + url.QueryEscape(byName+"/doc.json"), Options: []provider.Option{provider.WithAllowedHosts(su.Hostname())}},
+	}
+	for _, set := range denied {
+		hp := provider.NewHTTP(set.Options...)
+
+		// A provider that would serve the document is not consulted
+		// once the request is denied
+		mp := provider.NewMap()
+		mp.Set(set.Target, map[string]interface{}{"ok": true})
+		res := jsref.New()
+		res.AddProvider(hp)
+		res.AddProvider(mp)
+		_, err := res.Resolve(map[string]interface{}{"$ref": set.Target + "#/ok"}, "")
+		if !assert.Error(t, err, "%s: Resolve should fail", set.Name) {
+			return
+		}
+		if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "%s: error should match ErrPolicyViolation, got %v", set.Name, err) {
+			return
+		}
+		var perr *provider.PolicyViolationError
+		if !assert.True(t, errors.As(err, &perr), "%s: error should be a PolicyViolationError", set.Name) {
+			return
+		}
+		if !assert.Equal(t, set.Address, perr.Address != "", "%s: Address should be set when denied at connection", set.Name) {
+			return
+		}
+	}
+
+	// Connections denied by the policy are not retried
+	hp := provider.NewHTTP(
+		provider.WithBlockPrivateNetworks(true),
+		provider.WithRetry(provider.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}),
+	)
+	start := time.Now()
+	err = resolve(hp, byName+"/doc.json")
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Resolve should fail with ErrPolicyViolation, got %v", err) {
+		return
+	}
+	if !assert.True(t, time.Since(start) < 500*time.Millisecond, "Resolve should fail without retrying, took %s", time.Since(start)) {
+		return
+	}
+}
@@ -0,0 +1,20 @@
+package provider
+
+import "github.com/lestrrat-go/jsref/internal/jsondoc"
+
+// Position is a location within the source of a JSON document. It is
+// the same type as jsref.Position.
+type Position = jsondoc.Position
+
+// PositionIndex maps the JSON pointers of the values in a document
+// to their position in the source of the document. It is the same
+// type as jsref.PositionIndex, so the indexes returned by the
+// providers can be used by the resolver.
+type PositionIndex = jsondoc.PositionIndex
+
+// IndexPositions scans the JSON document in `src`, and records the
+// position where each of its values start. The index can be given
+// to `Map.SetPositions` for documents stored in a Map.
+func IndexPositions(src []byte) (*PositionIndex, error) {
+	return jsondoc.IndexPositions(src)
+}
@@ -0,0 +1,281 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how the HTTP provider retries requests that
+// failed because of a transient error: a timeout, a connection that
+// was refused, reset or closed too early, or a 408, 429, 500, 502, 503
+// or 504 response. Only GET and HEAD requests are retried.
+//
+// Fields that are not set use the values of DefaultRetryPolicy, except
+// for Jitter, which is disabled if it is zero.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the
+	// first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the delay after each retry
+	Multiplier float64
+	// Jitter is the fraction of each delay that is randomized, between
+	// 0 and 1, so that clients do not retry in lockstep
+	Jitter float64
+	// MaxRetryAfter is the longest delay requested by a Retry-After
+	// header that is honored. Responses that ask to wait longer are
+	// returned without being retried.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy whose values are used for the
+// fields of a RetryPolicy that are not set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.5,
+	MaxRetryAfter:  30 * time.Second,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = DefaultRetryPolicy.MaxRetryAfter
+	}
+	return p
+}
+
+// backoff returns the delay before the attempt following `attempt`,
+// starting from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// retryTransport retries the requests that failed because of a
+// transient error
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := t.next.RoundTrip(req)
+		if attempt >= t.policy.MaxAttempts || !retryable(req, res, err) {
+			return res, err
+		}
+
+		delay := t.policy.backoff(attempt)
+		if res != nil {
+			if d, ok := retryAfter(res); ok {
+				if d > t.policy.MaxRetryAfter {
+					return res, nil
+				}
+				delay = d
+			}
+			// Drain the body so that the connection can be reused
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		// Errors caused by the caller giving up are final. Other errors
+		// are only retried if they are transient: TLS, DNS or policy
+		// errors would happen again.
+		if req.Context().Err() != nil {
+			return false
+		}
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of
+// `res`, which is either a number of seconds or a date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		d := time.Until(at)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimit is the rate at which requests are allowed to a host
+type rateLimit struct {
+	host  string
+	rate  float64 // requests per second
+	burst int
+}
+
+// rateLimitTransport delays requests so that each host receives them
+// at the configured rate. Every attempt of a retried request counts.
+type rateLimitTransport struct {
+	next   http.RoundTripper
+	limits map[string]rateLimit // by host, "" applies to every host
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket // by host of the requests
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if b := t.bucket(req); b != nil {
+		if err := b.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// bucket returns the token bucket for the host of `req`, or nil if
+// requests to that host are not limited
+func (t *rateLimitTransport) bucket(req *http.Request) *tokenBucket {
+	key := matchHost(req.URL, t.limits)
+	limit, ok := t.limits[key]
+	if !ok {
+		limit, ok = t.limits[""]
+		if !ok {
+			return nil
+		}
+	}
+
+	// Hosts that share the default limit each get their own bucket
+	host := strings.ToLower(req.URL.Host)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.buckets[host]
+	if !ok {
+		b = newTokenBucket(limit.rate, limit.burst)
+		t.buckets[host] = b
+	}
+	return b
+}
+
+// tokenBucket allows `burst` requests at once, and `rate` requests per
+// second on average
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available, and takes it
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// Take the token right away, so that concurrent requests queue up
+	// behind each other
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if err := sleep(ctx, delay); err != nil {
+		// Give the token back
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package provider_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRetry(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/missing.json":
+			http.NotFound(w, r)
+		case r.URL.Path == "/later.json":
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case strings.HasPrefix(r.URL.Path, "/flaky") && n == 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case strings.HasPrefix(r.URL.Path, "/flaky") && n == 2:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"ok": true}`))
+		}
+	}))
+	defer srv.Close()
+
+	resolve := func(hp *provider.HTTP, path string) error {
+		res := jsref.New()
+		res.AddProvider(hp)
+		_, err := res.Resolve(map[string]interface{}{"$ref": srv.URL + path + "#/ok"}, "")
+		return err
+	}
+
+	if !assert.Error(t, resolve(provider.NewHTTP(), "/flaky1.json"), "Resolve should fail without retries") {
+		return
+	}
+
+	hp := provider.NewHTTP(provider.WithRetry(provider.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxRetryAfter:  time.Second,
+	}))
+	if !assert.NoError(t, resolve(hp, "/flaky2.json"), "Resolve should succeed after retrying") {
+		return
+	}
+	if !assert.Error(t, resolve(hp, "/missing.json"), "Resolve should fail on 404") {
+		return
+	}
+	if !assert.Error(t, resolve(hp, "/later.json"), "Resolve should fail when asked to retry much later") {
+		return
+	}
+	mu.Lock()
+	if !assert.Equal(t, map[string]int{"/flaky1.json": 1, "/flaky2.json": 3, "/missing.json": 1, "/later.json": 1}, attempts) {
+		mu.Unlock()
+		return
+	}
+	mu.Unlock()
+
+	// TLS failures are not transient
+	var connections int32
+	insecure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	insecure.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	insecure.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	insecure.StartTLS()
+	defer insecure.Close()
+
+	res := jsref.New()
+	res.AddProvider(hp)
+	_, err := res.Resolve(map[string]interface{}{"$ref": insecure.URL + "/doc.json#/ok"}, "")
+	if !assert.Error(t, err, "Resolve should fail with an untrusted certificate") {
+		return
+	}
+	if !assert.Equal(t, int32(1), atomic.LoadInt32(&connections), "TLS failures should not be retried") {
+		return
+	}
+
+	// 20 requests per second, so each request after the first waits
+	// for 50ms
+	hp = provider.NewHTTP(provider.WithRateLimit("", 20, 1))
+	start := time.Now()
+	for _, path := range []string{"/a.json", "/b.json", "/c.json"} {
+		if !assert.NoError(t, resolve(hp, path), "Resolve(%s) should succeed", path) {
+			return
+		}
+	}
+	if !assert.True(t, time.Since(start) >= 90*time.Millisecond, "requests should be rate limited, took %s", time.Since(start)) {
+		return
+	}
+}
@@ -0,0 +1,289 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/lestrrat-go/jsref/internal/jsondoc"
+	"github.com/pkg/errors"
+)
+
+// SnapshotMode specifies what the HTTP provider does with a snapshot
+// directory
+type SnapshotMode int
+
+const (
+	// SnapshotRecord saves the documents fetched by the HTTP provider
+	// in the snapshot directory
+	SnapshotRecord SnapshotMode = iota + 1
+	// SnapshotReplay serves the documents from the snapshot directory,
+	// without accessing the network. Requests for documents that were
+	// not recorded fail.
+	SnapshotReplay
+)
+
+// snapshotManifestName is the name of the file that maps URLs to the
+// files in a snapshot directory
+const snapshotManifestName = "manifest.json"
+
+// snapshotManifest is the content of the manifest of a snapshot
+// directory. For example:
+//
+//	{
+//	  "version": 1,
+//	  "entries": {
+//	    "https://example.com/schemas/pet.json": {
+//	      "status": 200,
+//	      "contentType": "application/json",
+//	      "file": "5f0c4d8ce1a2-pet.json",
+//	      "sha256": "..."
+//	    },
+//	    "https://example.com/latest.json": {
+//	      "status": 302,
+//	      "location": "https://example.com/v2.json"
+//	    }
+//	  }
+//	}
+//
+// Files are relative to the snapshot directory. Entries written by
+// hand may omit "status", which defaults to 200, and "sha256", in
+// which case the content of the file is not verified.
+type snapshotManifest struct {
+	Version int                       `json:"version"`
+	Entries map[string]*snapshotEntry `json:"entries"`
+}
+
+type snapshotEntry struct {
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Location    string `json:"location,omitempty"`
+	File        string `json:"file,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+type snapshotConfig struct {
+	dir  string
+	mode SnapshotMode
+}
+
+func readSnapshotManifest(dir string) (*snapshotManifest, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, snapshotManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m snapshotManifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse snapshot manifest")
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]*snapshotEntry)
+	}
+	return &m, nil
+}
+
+// snapshotKey returns the key of the manifest entry for `req`.
+// Credentials are removed from the URL, so that they are never
+// written to the manifest.
+func snapshotKey(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	u.Fragment = ""
+	return u.String()
+}
+
+// recordTransport saves the responses to the requests it makes in a
+// snapshot directory. Successful responses and redirects are recorded,
+// other responses are passed through. Responses larger than
+// `maxBytes`, as given with `WithMaxBytes`, are not recorded, and fail
+// like the documents that are too large.
+type recordTransport struct {
+	next     http.RoundTripper
+	dir      string
+	maxBytes int64 // zero means no limit
+
+	mu       sync.Mutex
+	manifest *snapshotManifest // loaded on first use
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet {
+		return res, err
+	}
+
+	entry := &snapshotEntry{Status: res.StatusCode}
+	var body []byte
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		var src io.Reader = res.Body
+		if t.maxBytes > 0 {
+			// Read one more byte than allowed, as the decoder does
+			src = io.LimitReader(src, t.maxBytes+1)
+		}
+		body, err = ioutil.ReadAll(src)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read response to record")
+		}
+		if t.maxBytes > 0 && int64(len(body)) > t.maxBytes {
+			return nil, &jsondoc.LimitError{Limit: "bytes", Max: t.maxBytes}
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		entry.ContentType = res.Header.Get("Content-Type")
+	case res.StatusCode >= 300 && res.StatusCode < 400 && res.Header.Get("Location") != "":
+		loc, err := res.Location()
+		if err != nil {
+			return res, nil
+		}
+		loc.User = nil
+		entry.Location = loc.String()
+	default:
+		return res, nil
+	}
+
+	if err := t.record(snapshotKey(req), entry, body); err != nil {
+		res.Body.Close()
+		return nil, errors.Wrapf(err, "failed to record %s", req.URL)
+	}
+	return res, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (t *recordTransport) record(key string, entry *snapshotEntry, body []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.manifest == nil {
+		m, err := readSnapshotManifest(t.dir)
+		switch {
+		case err == nil:
+			t.manifest = m
+		case os.IsNotExist(errors.Cause(err)):
+			t.manifest = &snapshotManifest{Entries: make(map[string]*snapshotEntry)}
+		default:
+			return err
+		}
+	}
+	t.manifest.Version = 1
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create snapshot directory")
+	}
+
+	if entry.Location == "" {
+		// Files are named after the URL, so that recording the same URL
+		// again replaces the previous file
+		sum := sha256.Sum256([]byte(key))
+		name := unsafeFileChars.ReplaceAllString(path.Base(key), "_")
+		entry.File = hex.EncodeToString(sum[:6]) + "-" + name
+		digest := sha256.Sum256(body)
+		entry.SHA256 = hex.EncodeToString(digest[:])
+		if err := writeFileAtomic(filepath.Join(t.dir, entry.File), body); err != nil {
+			return err
+		}
+	}
+	t.manifest.Entries[key] = entry
+
+	buf, err := json.MarshalIndent(t.manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode snapshot manifest")
+	}
+	return writeFileAtomic(filepath.Join(t.dir, snapshotManifestName), append(buf, '\n'))
+}
+
+// writeFileAtomic writes `buf` to a temporary file, and renames it to
+// `name`, so that readers never see a partially written file
+func writeFileAtomic(name string, buf []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-"+filepath.Base(name))
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+	return errors.Wrapf(os.Rename(f.Name(), name), "failed to write %s", name)
+}
+
+// replayTransport serves the responses recorded in a snapshot
+// directory, and never accesses the network
+type replayTransport struct {
+	dir string
+
+	once     sync.Once
+	err      error
+	manifest *snapshotManifest
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		t.manifest, t.err = readSnapshotManifest(t.dir)
+		if t.err != nil {
+			t.err = errors.Wrapf(t.err, "failed to load snapshot from %s", t.dir)
+		}
+	})
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	key := snapshotKey(req)
+	entry, ok := t.manifest.Entries[key]
+	if !ok {
+		return nil, errors.Errorf("%s was not recorded in snapshot %s", key, t.dir)
+	}
+
+	status := entry.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	if entry.Location != "" {
+		res.Header.Set("Location", entry.Location)
+	}
+	if entry.ContentType != "" {
+		res.Header.Set("Content-Type", entry.ContentType)
+	}
+
+	var body []byte
+	if entry.File != "" {
+		var err error
+		body, err = ioutil.ReadFile(filepath.Join(t.dir, filepath.FromSlash(path.Clean("/"+entry.File))))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read recorded response for %s", key)
+		}
+		if entry.SHA256 != "" {
+			digest := sha256.Sum256(body)
+			if hex.EncodeToString(digest[:]) != entry.SHA256 {
+				return nil, errors.Errorf("recorded response for %s does not match its checksum", key)
+			}
+		}
+	}
+	res.ContentLength = int64(len(body))
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
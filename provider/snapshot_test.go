@@ -0,0 +1,160 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jsref"
+	"github.com/lestrrat-go/jsref/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSnapshot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pet.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "dog"}`))
+		case "/latest.json":
+			http.Redirect(w, r, "/v2.json", http.StatusFound)
+		case "/v2.json":
+			w.Write([]byte(`{"version": 2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	doc := func() map[string]interface{} {
+		return map[string]interface{}{
+			"pet":     map[string]interface{}{"$ref": srv.URL + "/pet.json#/name"},
+			"version": map[string]interface{}{"$ref": srv.URL + "/latest.json#/version"},
+		}
+	}
+	expected := map[string]interface{}{"pet": "dog", "version": float64(2)}
+
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	res := jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(dir, provider.SnapshotRecord)))
+	v, err := res.Resolve(doc(), "", jsref.WithRecursiveResolution(true))
+	if !assert.NoError(t, err, "Resolve while recording should succeed") {
+		return
+	}
+	if !assert.Equal(t, expected, v) {
+		return
+	}
+	srv.Close()
+
+	var manifest struct {
+		Entries map[string]map[string]interface{} `json:"entries"`
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if !assert.NoError(t, err, "manifest should have been written") {
+		return
+	}
+	if !assert.NoError(t, json.Unmarshal(buf, &manifest), "manifest should be valid JSON") {
+		return
+	}
+	if !assert.Len(t, manifest.Entries, 3, "pet.json, latest.json and v2.json should be recorded") {
+		return
+	}
+	if !assert.Equal(t, srv.URL+"/v2.json", manifest.Entries[srv.URL+"/latest.json"]["location"]) {
+		return
+	}
+
+	// The server is gone, so everything must come from the snapshot
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(dir, provider.SnapshotReplay)))
+	v, err = res.Resolve(doc(), "", jsref.WithRecursiveResolution(true))
+	if !assert.NoError(t, err, "Resolve while replaying should succeed") {
+		return
+	}
+	if !assert.Equal(t, expected, v) {
+		return
+	}
+	_, err = res.Resolve(map[string]interface{}{"$ref": srv.URL + "/other.json"}, "")
+	if !assert.Error(t, err, "Resolve of a document that was not recorded should fail") {
+		return
+	}
+
+	// Snapshots can be written by hand
+	fixtures := t.TempDir()
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(fixtures, "manifest.json"), []byte(`{
+  "version": 1,
+  "entries": {"https://example.com/schema.json": {"file": "schema.json"}}
+}`), 0644), "WriteFile should succeed") {
+		return
+	}
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(fixtures, "schema.json"), []byte(`{"type": "object"}`), 0644), "WriteFile should succeed") {
+		return
+	}
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(fixtures, provider.SnapshotReplay)))
+	v, err = res.Resolve(map[string]interface{}{"$ref": "https://example.com/schema.json#/type"}, "")
+	if !assert.NoError(t, err, "Resolve from a fixture should succeed") {
+		return
+	}
+	if !assert.Equal(t, "object", v) {
+		return
+	}
+
+	// Replayed requests are still subject to the request policy
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(fixtures, provider.SnapshotReplay), provider.WithBlockPrivateNetworks(true)))
+	_, err = res.Resolve(map[string]interface{}{"$ref": "https://example.com/schema.json#/type"}, "")
+	if !assert.NoError(t, err, "Resolve from a fixture should succeed when blocking private networks") {
+		return
+	}
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(fixtures, provider.SnapshotReplay), provider.WithDeniedHosts("example.com")))
+	_, err = res.Resolve(map[string]interface{}{"$ref": "https://example.com/schema.json#/type"}, "")
+	if !assert.True(t, errors.Is(err, jsref.ErrPolicyViolation), "Resolve from a fixture of a denied host should fail, got %v", err) {
+		return
+	}
+
+	// Credentials are not written to the manifest, and responses are
+	// limited in size like documents
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pet.json":
+			w.Write([]byte(`{"name": "cat"}`))
+		case "/large.json":
+			w.Write([]byte(`{"name": "` + strings.Repeat("x", 100) + `"}`))
+		}
+	}))
+	defer private.Close()
+
+	dir = filepath.Join(t.TempDir(), "snapshot")
+	res = jsref.New()
+	res.AddProvider(provider.NewHTTP(provider.WithSnapshot(dir, provider.SnapshotRecord), provider.WithMaxBytes(64)))
+	withUser := strings.Replace(private.URL, "http://", "http://alice:s3cret@", 1)
+	v, err = res.Resolve(map[string]interface{}{"$ref": withUser + "/pet.json#/name"}, "")
+	if !assert.NoError(t, err, "Resolve while recording should succeed") {
+		return
+	}
+	if !assert.Equal(t, "cat", v) {
+		return
+	}
+	_, err = res.Resolve(map[string]interface{}{"$ref": private.URL + "/large.json#/name"}, "")
+	if !assert.True(t, errors.Is(err, jsref.ErrLimitExceeded), "Resolve of a large document should fail, got %v", err) {
+		return
+	}
+
+	buf, err = ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if !assert.NoError(t, err, "manifest should have been written") {
+		return
+	}
+	if !assert.Contains(t, string(buf), private.URL+"/pet.json", "pet.json should be recorded without credentials") {
+		return
+	}
+	for _, s := range []string{"alice", "s3cret", "large.json"} {
+		if !assert.NotContains(t, string(buf), s, "manifest should not contain %q", s) {
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package jsref
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// ResolveJSON works like `Resolve`, but takes a raw JSON document
+// instead of a pre-decoded value. The document is never decoded as a
+// whole: JSON pointers are evaluated by scanning the tokens of the
+// document, and only the subtrees that are actually referenced are
+// decoded into Go values.
+func (r *Resolver) ResolveJSON(src []byte, ptr string, options ...Option) (interface{}, error) {
+	if !json.Valid(src) {
+		return nil, errors.New("invalid JSON document")
+	}
+	return r.Resolve(json.RawMessage(src), ptr, options...)
+}
+
+// ResolveReadAll works like `ResolveJSON`, but reads the raw JSON
+// document from `rdr`. The document is not streamed: all of `rdr` is
+// read into memory before any reference is evaluated, as references
+// local to the document may point anywhere in it. Only the decoding
+// is deferred until needed.
+func (r *Resolver) ResolveReadAll(rdr io.Reader, ptr string, options ...Option) (interface{}, error) {
+	src, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read JSON document")
+	}
+	return r.ResolveJSON(src, ptr, options...)
+}
+
+// splitPointer splits a JSON pointer (without the leading '#') into
+// its unescaped reference tokens
+func splitPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+
+	if ptr[0] != '/' {
+		return nil, errors.Errorf("invalid JSON pointer %q", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, tok := range tokens {
+		if strings.IndexByte(tok, '~') < 0 {
+			continue
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+	}
+	return tokens, nil
+}
+
+// rawLookup evaluates the JSON pointer tokens against the raw JSON
+// document `src`, and returns the raw JSON of the value it points to.
+// Values that are not on the path are skipped without being decoded.
+func rawLookup(src []byte, tokens []string) (ret json.RawMessage, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("rawLookup(%s)", strings.Join(tokens, "/")).BindError(&err)
+		defer g.End()
+	}
+
+	cur := json.RawMessage(src)
+	for _, tok := range tokens {
+		dec := json.NewDecoder(bytes.NewReader(cur))
+		t, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read JSON token")
+		}
+
+		delim, ok := t.(json.Delim)
+		if !ok || (delim != '{' && delim != '[') {
+			return nil, errors.Errorf("token %q does not point to a container", tok)
+		}
+
+		if delim == '{' {
+			cur, err = rawSeekKey(dec, cur, tok)
+		} else {
+			cur, err = rawSeekIndex(dec, cur, tok)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tokens) > 0 {
+		return cur, nil
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(cur)).Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "failed to read JSON value")
+	}
+	return raw, nil
+}
+
+// rawSeekKey reads the rest of the object in `dec`, which reads from
+// `src`, and returns the raw JSON of the value for the object key
+// `key`. As with encoding/json, the last value wins if the key is
+// duplicated.
+func rawSeekKey(dec *json.Decoder, src []byte, key string) (json.RawMessage, error) {
+	var found json.RawMessage
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read JSON object key")
+		}
+
+		if t.(string) != key {
+			if err := rawSkip(dec); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if found, err = rawNext(dec, src); err != nil {
+			return nil, err
+		}
+	}
+	if found == nil {
+		return nil, errors.Errorf("object key %q not found", key)
+	}
+	return found, nil
+}
+
+// rawSeekIndex returns the raw JSON of the array element in `dec`,
+// which reads from `src`, at the index denoted by `tok`
+func rawSeekIndex(dec *json.Decoder, src []byte, tok string) (json.RawMessage, error) {
+	idx, err := strconv.Atoi(tok)
+	if err != nil || idx < 0 {
+		return nil, errors.Errorf("invalid array index %q", tok)
+	}
+
+	for i := 0; dec.More(); i++ {
+		if i == idx {
+			return rawNext(dec, src)
+		}
+		if err := rawSkip(dec); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.Errorf("array index %d out of bounds", idx)
+}
+
+// rawSkip skips over the next JSON value in `dec`
+func rawSkip(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return errors.Wrap(err, "failed to skip JSON value")
+		}
+
+		if delim, ok := t.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			default:
+				depth--
+			}
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// rawNext skips over the next JSON value in `dec`, which reads from
+// `src`, and returns its raw JSON. The value is sliced from `src`
+// rather than copied.
+func rawNext(dec *json.Decoder, src []byte) (json.RawMessage, error) {
+	start := dec.InputOffset()
+	if err := rawSkip(dec); err != nil {
+		return nil, err
+	}
+	// The value may be preceded by the separator from the previous
+	// token, which a value never starts with
+	return json.RawMessage(bytes.TrimLeft(src[start:dec.InputOffset()], " \t\r\n:,")), nil
+}
+
+// decodeRaw materializes a raw JSON value
+func decodeRaw(ctx *resolveCtx, raw json.RawMessage) (interface{}, error) {
+	v, err := decodeJSON(json.NewDecoder(bytes.NewReader(raw)), ctx.useNumber, ctx.ordered)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON value")
+	}
+	return v, nil
+}
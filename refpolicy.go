@@ -0,0 +1,149 @@
+package jsref
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReferencePolicy decides which references may be followed, based on
+// the document they are found in. It is consulted for each reference
+// to an external document, before any of the providers is called, so
+// that a document fetched from the network cannot make a provider
+// read local files, for example.
+type ReferencePolicy interface {
+	// CheckReference returns an error if the document at `origin` may
+	// not reference `target`. `origin` is empty for the document given
+	// to `Resolve`, unless its URI was given with `WithBaseURI`.
+	// `target` is the URL of the referenced document, without its
+	// fragment. Relative references are resolved against `origin`,
+	// although the providers are still given the reference as written.
+	CheckReference(origin, target *url.URL) error
+}
+
+// ReferencePolicyFunc is a function that implements ReferencePolicy
+type ReferencePolicyFunc func(origin, target *url.URL) error
+
+// CheckReference calls f(origin, target)
+func (f ReferencePolicyFunc) CheckReference(origin, target *url.URL) error {
+	return f(origin, target)
+}
+
+// OriginPolicy is a ReferencePolicy based on the schemes of the
+// referring and referenced documents
+type OriginPolicy struct {
+	// Schemes maps the scheme of a referring document to the schemes
+	// that its references may use. Documents whose scheme is not in the
+	// map may reference any scheme. The empty scheme stands for the
+	// document given to `Resolve` without a base URI, and for relative
+	// references found in it.
+	Schemes map[string][]string
+	// SameOrigin specifies that documents loaded over HTTP(S) may only
+	// reference HTTP(S) documents with the same scheme, host and port
+	SameOrigin bool
+}
+
+// SameOriginPolicy only allows documents loaded over HTTP(S) to
+// reference documents of the same origin, and "data" URLs, which
+// embed the referenced document. Documents embedded in "data" URLs
+// may only reference other "data" URLs, as they could have been
+// found in a remote document. Other documents, such as local files,
+// may reference anything.
+var SameOriginPolicy = OriginPolicy{
+	Schemes: map[string][]string{
+		"http":  {"http", "data"},
+		"https": {"https", "data"},
+		"data":  {"data"},
+	},
+	SameOrigin: true,
+}
+
+// CheckReference implements ReferencePolicy
+func (p OriginPolicy) CheckReference(origin, target *url.URL) error {
+	oscheme := strings.ToLower(origin.Scheme)
+	tscheme := strings.ToLower(target.Scheme)
+	if allowed, ok := p.Schemes[oscheme]; ok {
+		found := false
+		for _, s := range allowed {
+			if strings.EqualFold(s, tscheme) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("documents with scheme %q may not reference scheme %q", oscheme, tscheme)
+		}
+	}
+
+	if p.SameOrigin && isHTTPScheme(oscheme) && isHTTPScheme(tscheme) {
+		if o, t := urlOrigin(origin), urlOrigin(target); o != t {
+			return errors.Errorf("%s is not the same origin as %s", t, o)
+		}
+	}
+	return nil
+}
+
+func isHTTPScheme(s string) bool {
+	return s == "http" || s == "https"
+}
+
+// urlOrigin returns the scheme, host and port of `u`, normalized so
+// that default ports do not matter
+func urlOrigin(u *url.URL) string {
+	return normalizeURL(&url.URL{Scheme: u.Scheme, Host: u.Host})
+}
+
+// ReferencePolicyError is returned by `Resolve` when a reference is
+// denied by the ReferencePolicy
+type ReferencePolicyError struct {
+	// Origin is the URI of the document containing the reference. It
+	// is empty for the document given to `Resolve` without a base URI.
+	Origin string
+	// Target is the URL of the referenced document
+	Target string
+	// Err is the error returned by the policy
+	Err error
+}
+
+func (e *ReferencePolicyError) Error() string {
+	if e.Origin == "" {
+		return fmt.Sprintf("reference to %s %s: %s", e.Target, ErrPolicyViolation, e.Err)
+	}
+	return fmt.Sprintf("reference from %s to %s %s: %s", e.Origin, e.Target, ErrPolicyViolation, e.Err)
+}
+
+func (e *ReferencePolicyError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+func (e *ReferencePolicyError) Unwrap() error {
+	return e.Err
+}
+
+// checkReference applies the ReferencePolicy of the context to a
+// reference to `target`, found in the current document
+func (ctx *resolveCtx) checkReference(target *url.URL) error {
+	if ctx.refPolicy == nil {
+		return nil
+	}
+
+	origin, err := url.Parse(ctx.docURI)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the URI of document %q", ctx.docURI)
+	}
+	if !target.IsAbs() {
+		abs, err := ResolveURI(ctx.docURI, target.String())
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve %q against document %q", target, ctx.docURI)
+		}
+		if target, err = url.Parse(abs); err != nil {
+			return errors.Wrapf(err, "failed to parse reference %q", abs)
+		}
+	}
+	if err := ctx.refPolicy.CheckReference(origin, target); err != nil {
+		return &ReferencePolicyError{Origin: ctx.docURI, Target: target.String(), Err: err}
+	}
+	return nil
+}
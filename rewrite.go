@@ -0,0 +1,245 @@
+package jsref
+
+import (
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// RewriteFunc returns the new value for the reference `ref`, held by
+// `keyword`. Returning `ref` itself leaves the reference unchanged.
+type RewriteFunc func(keyword, ref string) (string, error)
+
+// RewriteRefs walks `v` and replaces the value of every reference
+// keyword registered in the Resolver with the value returned by `fn`.
+// References are not resolved, nor are documents loaded.
+//
+// `v` is modified in place, unless the `WithCopyOnWrite` option is
+// given, in which case a copy of `v` is returned. Structs can only be
+// modified in place if they are reached through a pointer.
+func (r *Resolver) RewriteRefs(v interface{}, fn RewriteFunc, options ...Option) (ret interface{}, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("Resolver.RewriteRefs").BindError(&err)
+		defer g.End()
+	}
+
+	rw := &rewriter{fn: fn, keywords: make(map[string]struct{})}
+	for _, kw := range r.keywordList() {
+		rw.keywords[kw.name] = struct{}{}
+	}
+	for _, opt := range options {
+		switch opt.Ident() {
+		case identCopyOnWrite{}:
+			rw.cow = opt.Value().(bool)
+		}
+	}
+
+	w := &walker{visitor: rw, cow: rw.cow}
+	rv, err := w.walk(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	return rv.Interface(), nil
+}
+
+// rewriter is the walkVisitor that rewrites the references within a
+// document for `RewriteRefs`
+type rewriter struct {
+	fn       RewriteFunc
+	keywords map[string]struct{}
+	cow      bool
+	path     []string
+}
+
+func (rw *rewriter) enter(reflect.Value) {}
+
+func (rw *rewriter) push(tok string) {
+	rw.path = append(rw.path, tok)
+}
+
+func (rw *rewriter) pop() {
+	rw.path = rw.path[:len(rw.path)-1]
+}
+
+func (rw *rewriter) visit(tok string, v reflect.Value) (reflect.Value, bool, error) {
+	s, ok := rw.refValue(tok, v)
+	if !ok {
+		return v, true, nil
+	}
+
+	newref, err := rw.fn(tok, s)
+	if err != nil {
+		return zeroval, false, errors.Wrapf(err, "failed to rewrite reference at %s", joinPointer(rw.path))
+	}
+	if newref == s {
+		return v, false, nil
+	}
+	return reflect.ValueOf(newref), false, nil
+}
+
+// refValue returns the reference held by `v`, if `key` is one of the
+// reference keywords and `v` is a string
+func (rw *rewriter) refValue(key string, v reflect.Value) (string, bool) {
+	if _, ok := rw.keywords[key]; !ok {
+		return "", false
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// PrefixRewrite returns a RewriteFunc that replaces the prefixes of
+// references according to `mapping`, such as "old.json#/definitions/"
+// to "new.json#/$defs/". The longest matching prefix is used.
+func PrefixRewrite(mapping map[string]string) RewriteFunc {
+	prefixes := make([]string, 0, len(mapping))
+	for prefix := range mapping {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(_, ref string) (string, error) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref, prefix) {
+				return mapping[prefix] + ref[len(prefix):], nil
+			}
+		}
+		return ref, nil
+	}
+}
+
+// ChainRewrites returns a RewriteFunc that applies each of `fns` in
+// order
+func ChainRewrites(fns ...RewriteFunc) RewriteFunc {
+	return func(keyword, ref string) (string, error) {
+		for _, fn := range fns {
+			var err error
+			ref, err = fn(keyword, ref)
+			if err != nil {
+				return "", err
+			}
+		}
+		return ref, nil
+	}
+}
+
+// AbsolutizeRefs returns a RewriteFunc that resolves references
+// against `base`, the URI of the document that holds them. References
+// local to the document become "<base>#<fragment>".
+func AbsolutizeRefs(base string) RewriteFunc {
+	return func(_, ref string) (string, error) {
+		return ResolveURI(base, ref)
+	}
+}
+
+// RelativizeRefs returns a RewriteFunc that makes references relative
+// to `base`, the URI of the document that holds them. References to
+// `base` itself become fragment-only references, and references to
+// other hosts or schemes are left untouched.
+func RelativizeRefs(base string) RewriteFunc {
+	return func(_, ref string) (string, error) {
+		abs, err := ResolveURI(base, ref)
+		if err != nil {
+			return "", err
+		}
+		bu, err := url.Parse(base)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to parse base URI %q", base)
+		}
+		u, err := url.Parse(abs)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to parse reference %q", abs)
+		}
+
+		if u.Scheme != bu.Scheme || u.Host != bu.Host || u.User.String() != bu.User.String() || u.Opaque != bu.Opaque {
+			return ref, nil
+		}
+
+		out := &url.URL{RawQuery: u.RawQuery, Fragment: u.Fragment}
+		if u.Path != bu.Path || u.RawQuery != bu.RawQuery {
+			out.Path = relativePath(bu.Path, u.Path)
+		}
+		s := out.String()
+		if s == "" {
+			// A reference to the whole document
+			s = "#"
+		}
+		return s, nil
+	}
+}
+
+// ResolveURI resolves the reference `ref` against `base`. Unlike
+// `url.URL.ResolveReference`, relative bases such as
+// "schemas/pets.json" are supported, and stay relative. It is the
+// resolution used by `AbsolutizeRefs` and `RelativizeRefs`, exported
+// so that the openapi package and the jsref command resolve references
+// the same way.
+func ResolveURI(base, ref string) (string, error) {
+	if base == "" {
+		return ref, nil
+	}
+
+	ru, err := url.Parse(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse reference %q", ref)
+	}
+	bu, err := url.Parse(base)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse base URI %q", base)
+	}
+	if bu.IsAbs() || bu.Host != "" {
+		return bu.ResolveReference(ru).String(), nil
+	}
+	if ru.IsAbs() || ru.Host != "" {
+		return ref, nil
+	}
+
+	out := *bu
+	out.Fragment = ru.Fragment
+	switch {
+	case ru.Path == "" && ru.RawQuery == "":
+	case strings.HasPrefix(ru.Path, "/"):
+		out.Path = ru.Path
+		out.RawQuery = ru.RawQuery
+	default:
+		out.Path = path.Join(path.Dir(bu.Path), ru.Path)
+		if strings.HasSuffix(ru.Path, "/") {
+			out.Path += "/"
+		}
+		out.RawQuery = ru.RawQuery
+	}
+	return out.String(), nil
+}
+
+// relativePath returns the path of `target` relative to the
+// directory of `base`
+func relativePath(base, target string) string {
+	from := strings.Split(path.Dir(base), "/")
+	to := strings.Split(target, "/")
+
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+
+	var parts []string
+	for j := i; j < len(from); j++ {
+		if from[j] != "" && from[j] != "." {
+			parts = append(parts, "..")
+		}
+	}
+	parts = append(parts, to[i:]...)
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,159 @@
+package jsref
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// SiblingPolicy controls what happens to the keys that appear next to
+// a "$ref" key in the same object, such as "description" in
+//
+//	{"$ref": "#/definitions/A", "description": "override"}
+type SiblingPolicy int
+
+const (
+	// IgnoreSiblings replaces the entire object with the referenced
+	// value, discarding any sibling keys. This is the behavior
+	// mandated by JSON Reference and JSON Schema draft-04.
+	IgnoreSiblings SiblingPolicy = iota
+	// MergeSiblings overlays the sibling keys on top of a shallow copy
+	// of the referenced object. The referenced value must be an object.
+	MergeSiblings
+	// AllOfSiblings wraps the referenced value and the sibling keys
+	// into an `allOf` construct, i.e.
+	//
+	//    {"allOf": [<referenced value>, {<sibling keys>}]}
+	AllOfSiblings
+)
+
+func (p SiblingPolicy) String() string {
+	switch p {
+	case IgnoreSiblings:
+		return "IgnoreSiblings"
+	case MergeSiblings:
+		return "MergeSiblings"
+	case AllOfSiblings:
+		return "AllOfSiblings"
+	}
+	return "SiblingPolicy(unknown)"
+}
+
+// applySiblingPolicy combines the referenced value `target` with the
+// keys that appear next to the reference keyword in `v`.
+func applySiblingPolicy(ctx *resolveCtx, keyword string, v, target interface{}) (interface{}, error) {
+	policy := ctx.siblings
+	if policy == IgnoreSiblings {
+		return target, nil
+	}
+
+	// Raw JSON objects are decoded to find their sibling keys, in the
+	// same way as the referenced value
+	if raw, ok := v.(json.RawMessage); ok {
+		decoded, err := decodeRaw(ctx, raw)
+		if err != nil {
+			return nil, err
+		}
+		v = decoded
+	}
+
+	siblings := refSiblings(keyword, v)
+	if siblings == nil {
+		return target, nil
+	}
+
+	switch policy {
+	case MergeSiblings:
+		merged, ok := cloneObject(target)
+		if !ok {
+			return nil, errors.New("cannot merge sibling keys into a value that is not an object")
+		}
+		for _, key := range siblings.Keys() {
+			value, _ := siblings.Get(key)
+			setObjectKey(merged, key, value)
+		}
+		return merged, nil
+	case AllOfSiblings:
+		if _, ok := v.(*OrderedMap); ok {
+			wrapper := NewOrderedMap()
+			wrapper.Set("allOf", []interface{}{target, siblings})
+			return wrapper, nil
+		}
+
+		m := make(map[string]interface{}, siblings.Len())
+		for _, key := range siblings.Keys() {
+			m[key], _ = siblings.Get(key)
+		}
+		return map[string]interface{}{
+			"allOf": []interface{}{target, m},
+		}, nil
+	}
+	return nil, errors.Errorf("unknown sibling policy %s", policy)
+}
+
+// refSiblings returns the keys in `v` other than the reference keyword,
+// or nil if there are none. Only maps with string keys and *OrderedMap
+// are inspected; structs never have siblings.
+func refSiblings(keyword string, v interface{}) *OrderedMap {
+	siblings := NewOrderedMap()
+	if om, ok := v.(*OrderedMap); ok {
+		for _, key := range om.Keys() {
+			if key == keyword {
+				continue
+			}
+			value, _ := om.Get(key)
+			siblings.Set(key, value)
+		}
+	} else {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range rv.MapKeys() {
+			if key.String() == keyword {
+				continue
+			}
+			siblings.Set(key.String(), rv.MapIndex(key).Interface())
+		}
+	}
+
+	if siblings.Len() == 0 {
+		return nil
+	}
+	return siblings
+}
+
+// cloneObject creates a shallow copy of an object, so that it can be
+// modified without touching the referenced document
+func cloneObject(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case *OrderedMap:
+		om := NewOrderedMap()
+		for _, key := range v.Keys() {
+			value, _ := v.Get(key)
+			om.Set(key, value)
+		}
+		return om, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	m := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		m[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return m, true
+}
+
+func setObjectKey(v interface{}, key string, value interface{}) {
+	switch v := v.(type) {
+	case *OrderedMap:
+		v.Set(key, value)
+	case map[string]interface{}:
+		v[key] = value
+	}
+}
@@ -0,0 +1,108 @@
+package jsref
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// TypeError is returned by `ResolveAs` and `GetAs` when the resolved
+// value cannot be converted to the requested type
+type TypeError struct {
+	// Source is the JSON pointer or the URL that was resolved
+	Source string
+	// Expected is the requested type
+	Expected reflect.Type
+	// Actual is the type of the resolved value, or nil if the value
+	// was null
+	Actual reflect.Type
+	// Err is the reason why the value could not be converted
+	Err error
+}
+
+func (e *TypeError) Error() string {
+	actual := "null"
+	if e.Actual != nil {
+		actual = e.Actual.String()
+	}
+	return fmt.Sprintf("%s: cannot convert %s at %s to %s: %s", ErrTypeMismatch, actual, e.Source, e.Expected, e.Err)
+}
+
+func (e *TypeError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
+
+func (e *TypeError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveAs resolves `ptr` against `v` like `r.Resolve` does, and
+// returns the result as a `T`.
+//
+// Values that already are of type `T` are returned as they are. Other
+// values, such as the `map[string]interface{}` objects of a decoded
+// JSON document, are converted through their JSON representation, so
+// `T` may be a struct or any other type that JSON can be decoded into.
+// A `*TypeError` is returned if the conversion fails.
+func ResolveAs[T any](r *Resolver, v interface{}, ptr string, options ...Option) (T, error) {
+	var zero T
+	x, err := r.Resolve(v, ptr, options...)
+	if err != nil {
+		return zero, err
+	}
+	return convertTo[T](x, ptr)
+}
+
+// GetAs fetches the document at `u` from `p`, and returns it as a `T`.
+// The document is converted like `ResolveAs` does.
+func GetAs[T any](p Provider, u *url.URL) (T, error) {
+	var zero T
+	x, err := p.Get(u)
+	if err != nil {
+		return zero, err
+	}
+	return convertTo[T](x, u.String())
+}
+
+func convertTo[T any](x interface{}, source string) (T, error) {
+	if v, ok := x.(T); ok {
+		return v, nil
+	}
+
+	var v T
+	typeError := func(err error) (T, error) {
+		var zero T
+		return zero, &TypeError{
+			Source:   source,
+			Expected: reflect.TypeOf(&v).Elem(),
+			Actual:   reflect.TypeOf(x),
+			Err:      err,
+		}
+	}
+
+	if x == nil {
+		// JSON decoding would silently leave `v` untouched, so null is
+		// only accepted for types that have a nil value
+		switch reflect.TypeOf(&v).Elem().Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			return v, nil
+		}
+		return typeError(errors.New("value is null"))
+	}
+
+	buf, ok := x.(json.RawMessage)
+	if !ok {
+		var err error
+		buf, err = json.Marshal(x)
+		if err != nil {
+			return typeError(errors.Wrap(err, "failed to encode value"))
+		}
+	}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return typeError(err)
+	}
+	return v, nil
+}
@@ -0,0 +1,257 @@
+package jsref
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/pkg/errors"
+)
+
+// walkVisitor is called by a walker for the values within a document
+type walkVisitor interface {
+	// enter is called with each map, *OrderedMap and slice before its
+	// children are visited
+	enter(rv reflect.Value)
+	// push and pop are called around the visit of each child, with its
+	// reference token
+	push(tok string)
+	pop()
+	// visit is called for each child of a container. It returns the
+	// value that replaces the child, which may be `v` itself, and
+	// whether the children of that value should be visited in turn.
+	visit(tok string, v reflect.Value) (reflect.Value, bool, error)
+}
+
+// walker visits the values within a document the way they would be
+// laid out in JSON: the values of maps and *OrderedMap, the elements
+// of slices and arrays, and the exported fields of structs. Children
+// are replaced with the values returned by the visitor.
+//
+// Containers are modified in place, unless `cow` is set, in which case
+// the containers on the way to a modified value are copied. Structs
+// and arrays that cannot be modified in place are copied as well.
+type walker struct {
+	visitor walkVisitor
+	cow     bool
+}
+
+func (w *walker) walk(rv reflect.Value) (reflect.Value, error) {
+	if rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return rv, nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return rv, nil
+	}
+	if rv.CanInterface() {
+		if om, ok := rv.Interface().(*OrderedMap); ok {
+			return w.walkOrderedMap(om)
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return rv, nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			if w.cow {
+				rv = cloneStruct(rv)
+			}
+			return rv, w.walkStruct(rv.Elem())
+		}
+		elem, err := w.walk(rv.Elem())
+		if err != nil {
+			return zeroval, err
+		}
+		if w.cow {
+			rv = reflect.New(rv.Type().Elem())
+		}
+		return rv, setValue(rv.Elem(), elem)
+	case reflect.Struct:
+		if w.cow || !rv.CanSet() {
+			out := reflect.New(rv.Type()).Elem()
+			out.Set(rv)
+			rv = out
+		}
+		return rv, w.walkStruct(rv)
+	case reflect.Array:
+		if w.cow || !rv.CanSet() {
+			out := reflect.New(rv.Type()).Elem()
+			reflect.Copy(out, rv)
+			rv = out
+		}
+		return rv, w.walkElements(rv)
+	case reflect.Slice:
+		if w.cow {
+			rv = cloneSlice(rv, rv.Len())
+		}
+		w.visitor.enter(rv)
+		return rv, w.walkElements(rv)
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv, nil
+		}
+		if w.cow {
+			rv = cloneMap(rv)
+		}
+		w.visitor.enter(rv)
+
+		// Sort the keys, so that errors are reported consistently
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return mapKeyToken(keys[i]) < mapKeyToken(keys[j]) })
+		for _, key := range keys {
+			newv, err := w.child(mapKeyToken(key), rv.MapIndex(key))
+			if err != nil {
+				return zeroval, err
+			}
+			x, err := assignable(newv.Interface(), rv.Type().Elem())
+			if err != nil {
+				return zeroval, err
+			}
+			rv.SetMapIndex(key, x)
+		}
+		return rv, nil
+	}
+	return rv, nil
+}
+
+func (w *walker) walkOrderedMap(om *OrderedMap) (reflect.Value, error) {
+	if w.cow {
+		om = cloneOrderedMap(om)
+	}
+	w.visitor.enter(reflect.ValueOf(om))
+	for _, key := range om.Keys() {
+		v, _ := om.Get(key)
+		// Go through a pointer, so that null values are valid too
+		newv, err := w.child(key, reflect.ValueOf(&v).Elem())
+		if err != nil {
+			return zeroval, err
+		}
+		om.Set(key, newv.Interface())
+	}
+	return reflect.ValueOf(om), nil
+}
+
+func (w *walker) walkElements(rv reflect.Value) error {
+	for i := 0; i < rv.Len(); i++ {
+		newv, err := w.child(strconv.Itoa(i), rv.Index(i))
+		if err != nil {
+			return err
+		}
+		if err := setValue(rv.Index(i), newv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkStruct(rv reflect.Value) error {
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		newv, err := w.child(structFieldToken(rv.Type(), i), rv.Field(i))
+		if err != nil {
+			return err
+		}
+		if err := setValue(rv.Field(i), newv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// child visits the child `v` of a container, and the values within
+// the value that replaces it
+func (w *walker) child(tok string, v reflect.Value) (reflect.Value, error) {
+	w.visitor.push(tok)
+	defer w.visitor.pop()
+
+	newv, descend, err := w.visitor.visit(tok, v)
+	if err != nil {
+		return zeroval, err
+	}
+	if !descend {
+		return newv, nil
+	}
+	return w.walk(newv)
+}
+
+// setValue stores `v` in `dst`, unless it is already there
+func setValue(dst, v reflect.Value) error {
+	if v == dst {
+		return nil
+	}
+	x, err := assignable(v.Interface(), dst.Type())
+	if err != nil {
+		return err
+	}
+	dst.Set(x)
+	return nil
+}
+
+// expander is the walkVisitor that expands the references within the
+// result of `Resolve` when resolving recursively
+type expander struct {
+	ctx *resolveCtx
+	r   *Resolver
+}
+
+func (e *expander) enter(rv reflect.Value) {
+	e.ctx.visit(rv)
+}
+
+func (e *expander) push(tok string) {
+	e.ctx.pushPath(tok)
+}
+
+func (e *expander) pop() {
+	e.ctx.popPath()
+}
+
+func (e *expander) visit(tok string, v reflect.Value) (reflect.Value, bool, error) {
+	if err := e.ctx.usage.node(); err != nil {
+		return zeroval, false, err
+	}
+
+	newv, err := expandRefAt(e.ctx, e.r, v.Interface())
+	if err != nil {
+		return zeroval, false, errors.Wrapf(err, "failed to expand %q", tok)
+	}
+	if newv == nil {
+		return reflect.Zero(v.Type()), false, nil
+	}
+	return reflect.ValueOf(newv), true, nil
+}
+
+// traverseExpandRefRecursive expands the references within `v`,
+// including `v` itself
+func traverseExpandRefRecursive(ctx *resolveCtx, r *Resolver, v interface{}) (interface{}, error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("traverseExpandRefRecursive")
+		defer g.End()
+	}
+
+	if _, _, err := findRef(r, v); err == nil {
+		newv, err := expandRefAt(ctx, r, v)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to expand value")
+		}
+		v = newv
+	}
+
+	w := &walker{visitor: &expander{ctx: ctx, r: r}}
+	rv, err := w.walk(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if !rv.IsValid() {
+		return v, nil
+	}
+	return rv.Interface(), nil
+}
@@ -0,0 +1,370 @@
+package jsref
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lestrrat-go/pdebug"
+	"github.com/lestrrat-go/structinfo"
+	"github.com/pkg/errors"
+)
+
+// WriteResult describes the document that was modified by `Set` or
+// `Delete`
+type WriteResult struct {
+	// Document is the URI of the modified document. It is the URI
+	// given with `WithBaseURI` if the document passed to `Set` or
+	// `Delete` was modified.
+	Document string
+	// Pointer is the JSON pointer to the modified value within Document
+	Pointer string
+	// Refs is the chain of references that were followed to reach
+	// Document
+	Refs []string
+	// Value is the modified document. Unless `WithCopyOnWrite` was
+	// given, it is the document itself, modified in place. It only
+	// differs from the original when the root of the document had to
+	// be replaced, such as when appending to an array at the root.
+	Value interface{}
+}
+
+// Set sets the value at the JSON pointer `ptr` within `v` to `value`.
+// References found on the way to `ptr` are followed, so the value is
+// set in the document that actually contains it, which may be a
+// document loaded from one of the providers. The reference token "-"
+// appends to an array.
+//
+// Documents are modified in place, unless the `WithCopyOnWrite`
+// option is given. Documents given as raw JSON cannot be modified.
+// The references are followed according to the same options as
+// `Resolve`, such as `WithReferencePolicy` and `WithLockfile`.
+func (r *Resolver) Set(v interface{}, ptr string, value interface{}, options ...Option) (*WriteResult, error) {
+	return r.write(v, ptr, value, false, options)
+}
+
+// Delete removes the value at the JSON pointer `ptr` within `v`,
+// following references like `Set` does. Elements removed from an
+// array shift the following elements, and fields removed from a
+// struct are set to their zero value.
+func (r *Resolver) Delete(v interface{}, ptr string, options ...Option) (*WriteResult, error) {
+	return r.write(v, ptr, nil, true, options)
+}
+
+func (r *Resolver) write(v interface{}, ptr string, value interface{}, del bool, options []Option) (ret *WriteResult, err error) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("Resolver.write(%s)", ptr).BindError(&err)
+		defer g.End()
+	}
+
+	opts := r.resolveOptions(options)
+	baseURI := opts.baseURI
+
+	tokens, err := splitPointer(strings.TrimPrefix(ptr, "#"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSON pointer")
+	}
+	if len(tokens) == 0 {
+		if del {
+			return nil, errors.New("cannot delete the root of a document")
+		}
+		return &WriteResult{Document: baseURI, Value: value}, nil
+	}
+
+	ctx := opts.newResolveCtx(r, v, "")
+
+	// Find the document that holds the container of the value, and
+	// the location of the container within that document
+	doc := v
+	docURI := baseURI
+	var docTokens []string
+	var refs []string
+	node := v
+	for i, tok := range tokens {
+		if _, _, err := findRef(r, node); err == nil {
+			c := &resolveCtx{}
+			*c = *ctx
+			c.object = doc
+			c.docURI = docURI
+			c.inRoot = false
+			c.located = &Location{Document: docURI, Pointer: joinPointer(docTokens)}
+			c.holder = nil
+
+			node, err = expandRefRecursive(c, r, node)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to follow reference at %s", joinPointer(tokens[:i]))
+			}
+			if c.located == nil || c.holder == nil {
+				return nil, errors.Errorf("cannot determine the location of the value referenced at %s", joinPointer(tokens[:i]))
+			}
+			docTokens, err = splitPointer(c.located.Pointer)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot write through reference at %s", joinPointer(tokens[:i]))
+			}
+			doc = c.holder.object
+			docURI = c.located.Document
+			refs = append(refs, c.located.Refs...)
+		}
+
+		if i == len(tokens)-1 {
+			break
+		}
+
+		node, err = pointerChild(node, tok)
+		if err != nil {
+			return nil, errors.Wrapf(err, "match to JSON pointer not found: %s", joinPointer(tokens[:i+1]))
+		}
+		docTokens = append(docTokens, tok)
+	}
+
+	if _, ok := doc.(json.RawMessage); ok {
+		return nil, errors.Errorf("cannot modify raw JSON document %q", docURI)
+	}
+
+	docTokens = append(docTokens, tokens[len(tokens)-1])
+	w := &writer{value: value, del: del, cow: opts.cow}
+	newdoc, err := w.write(doc, docTokens)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to modify %s#%s", docURI, joinPointer(docTokens))
+	}
+
+	return &WriteResult{
+		Document: docURI,
+		Pointer:  joinPointer(docTokens),
+		Refs:     refs,
+		Value:    newdoc,
+	}, nil
+}
+
+func joinPointer(tokens []string) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteByte('/')
+		b.WriteString(EscapePointerToken(tok))
+	}
+	return b.String()
+}
+
+// writer applies a single modification to a document
+type writer struct {
+	value interface{}
+	del   bool
+	cow   bool
+}
+
+// write returns `node` with the modification applied at `tokens`.
+// In copy-on-write mode, the containers on the path are copied.
+func (w *writer) write(node interface{}, tokens []string) (interface{}, error) {
+	tok := tokens[0]
+	if len(tokens) == 1 {
+		if w.del {
+			return w.deleteChild(node, tok)
+		}
+		return w.setChild(node, tok, w.value)
+	}
+
+	child, err := pointerChild(node, tok)
+	if err != nil {
+		return nil, err
+	}
+	newchild, err := w.write(child, tokens[1:])
+	if err != nil {
+		return nil, err
+	}
+	return w.setChild(node, tok, newchild)
+}
+
+func (w *writer) setChild(node interface{}, tok string, value interface{}) (interface{}, error) {
+	if om, ok := node.(*OrderedMap); ok {
+		if w.cow {
+			om = cloneOrderedMap(om)
+		}
+		om.Set(tok, value)
+		return om, nil
+	}
+
+	rv := reflect.ValueOf(node)
+	switch rv.Kind() {
+	case reflect.Map:
+		switch {
+		case rv.IsNil():
+			// The new map replaces the nil one in the parent
+			rv = reflect.MakeMap(rv.Type())
+		case w.cow:
+			rv = cloneMap(rv)
+		}
+		kv, err := mapKey(rv.Type().Key(), tok)
+		if err != nil {
+			return nil, err
+		}
+		x, err := assignable(value, rv.Type().Elem())
+		if err != nil {
+			return nil, err
+		}
+		rv.SetMapIndex(kv, x)
+		return rv.Interface(), nil
+	case reflect.Slice:
+		x, err := assignable(value, rv.Type().Elem())
+		if err != nil {
+			return nil, err
+		}
+		if tok == "-" || tok == strconv.Itoa(rv.Len()) {
+			if w.cow {
+				rv = cloneSlice(rv, rv.Len()+1)
+				rv.Index(rv.Len() - 1).Set(x)
+				return rv.Interface(), nil
+			}
+			return reflect.Append(rv, x).Interface(), nil
+		}
+		idx, err := sliceIndex(rv, tok)
+		if err != nil {
+			return nil, err
+		}
+		if w.cow {
+			rv = cloneSlice(rv, rv.Len())
+		}
+		rv.Index(idx).Set(x)
+		return rv.Interface(), nil
+	case reflect.Ptr:
+		if rv.Elem().Kind() != reflect.Struct {
+			break
+		}
+		if w.cow {
+			rv = cloneStruct(rv)
+		}
+		field, err := structField(rv.Elem(), tok)
+		if err != nil {
+			return nil, err
+		}
+		x, err := assignable(value, field.Type())
+		if err != nil {
+			return nil, err
+		}
+		field.Set(x)
+		return rv.Interface(), nil
+	}
+	return nil, errors.Errorf("cannot set %q in a %s", tok, rv.Kind())
+}
+
+func (w *writer) deleteChild(node interface{}, tok string) (interface{}, error) {
+	if om, ok := node.(*OrderedMap); ok {
+		if _, ok := om.Get(tok); !ok {
+			return nil, errors.Errorf("key %q not found", tok)
+		}
+		if w.cow {
+			om = cloneOrderedMap(om)
+		}
+		om.Delete(tok)
+		return om, nil
+	}
+
+	rv := reflect.ValueOf(node)
+	switch rv.Kind() {
+	case reflect.Map:
+		kv, err := mapKey(rv.Type().Key(), tok)
+		if err != nil {
+			return nil, err
+		}
+		if !rv.MapIndex(kv).IsValid() {
+			return nil, errors.Errorf("key %q not found", tok)
+		}
+		if w.cow {
+			rv = cloneMap(rv)
+		}
+		rv.SetMapIndex(kv, reflect.Value{})
+		return rv.Interface(), nil
+	case reflect.Slice:
+		idx, err := sliceIndex(rv, tok)
+		if err != nil {
+			return nil, err
+		}
+		out := reflect.MakeSlice(rv.Type(), 0, rv.Len()-1)
+		out = reflect.AppendSlice(out, rv.Slice(0, idx))
+		out = reflect.AppendSlice(out, rv.Slice(idx+1, rv.Len()))
+		if !w.cow {
+			// Keep the backing array, so that other references to
+			// the slice see the change
+			reflect.Copy(rv, out)
+			rv.Index(rv.Len() - 1).Set(reflect.Zero(rv.Type().Elem()))
+			out = rv.Slice(0, rv.Len()-1)
+		}
+		return out.Interface(), nil
+	case reflect.Ptr:
+		if rv.Elem().Kind() != reflect.Struct {
+			break
+		}
+		if w.cow {
+			rv = cloneStruct(rv)
+		}
+		field, err := structField(rv.Elem(), tok)
+		if err != nil {
+			return nil, err
+		}
+		field.Set(reflect.Zero(field.Type()))
+		return rv.Interface(), nil
+	}
+	return nil, errors.Errorf("cannot delete %q from a %s", tok, rv.Kind())
+}
+
+// assignable converts `value` so that it can be stored in a container
+// whose elements are of type `t`
+func assignable(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+	x := reflect.ValueOf(value)
+	if !x.Type().AssignableTo(t) {
+		return zeroval, errors.Errorf("cannot store a %s in a container of %s", x.Type(), t)
+	}
+	return x, nil
+}
+
+func sliceIndex(rv reflect.Value, tok string) (int, error) {
+	idx, err := strconv.Atoi(tok)
+	if err != nil {
+		return 0, errors.Errorf("invalid array index %q", tok)
+	}
+	if idx < 0 || idx >= rv.Len() {
+		return 0, errors.Errorf("array index %d out of bounds", idx)
+	}
+	return idx, nil
+}
+
+func structField(rv reflect.Value, tok string) (reflect.Value, error) {
+	fn := structinfo.StructFieldFromJSONName(rv, tok)
+	if fn == "" {
+		return zeroval, errors.Errorf("field %q not found", tok)
+	}
+	return rv.FieldByName(fn), nil
+}
+
+func cloneOrderedMap(om *OrderedMap) *OrderedMap {
+	out := NewOrderedMap()
+	for _, key := range om.Keys() {
+		v, _ := om.Get(key)
+		out.Set(key, v)
+	}
+	return out
+}
+
+func cloneMap(rv reflect.Value) reflect.Value {
+	out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		out.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return out
+}
+
+func cloneSlice(rv reflect.Value, n int) reflect.Value {
+	out := reflect.MakeSlice(rv.Type(), n, n)
+	reflect.Copy(out, rv)
+	return out
+}
+
+func cloneStruct(rv reflect.Value) reflect.Value {
+	out := reflect.New(rv.Elem().Type())
+	out.Elem().Set(rv.Elem())
+	return out
+}